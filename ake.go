@@ -32,7 +32,12 @@ type ake struct {
 	state authState
 	keys  keyManagementContext
 
+	// ssid is only made the ssid of the conversation when the AKE has finished,
+	// so that a session being refreshed keeps its ssid until then
+	ssid [8]byte
+
 	lastStateChange time.Time
+	started         time.Time
 }
 
 func (c *Conversation) ensureAKE() {
@@ -45,12 +50,13 @@ func (c *Conversation) ensureAKE() {
 
 func (c *Conversation) initAKE() {
 	c.ake = &ake{
-		state: authStateNone{},
+		state:   authStateNone{},
+		started: time.Now(),
 	}
 }
 
 func (c *Conversation) calcAKEKeys(s *big.Int) {
-	c.ssid, c.ake.revealKey, c.ake.sigKey = calculateAKEKeys(s, c.version)
+	c.ake.ssid, c.ake.revealKey, c.ake.sigKey = calculateAKEKeys(s, c.version)
 }
 
 func (c *Conversation) setSecretExponent(val secretKeyValue) {
@@ -75,11 +81,11 @@ func (c *Conversation) generateEncryptedSignature(key *akeKeys) ([]byte, error)
 	return AppendData(nil, xb), nil
 }
 func appendAll(one, two *big.Int, publicKey PublicKey, keyID uint32) []byte {
-	return AppendWord(append(AppendMPI(AppendMPI(nil, one), two), publicKey.serialize()...), keyID)
+	return AppendWord(append(AppendMPI(AppendMPI(nil, one), two), publicKey.Serialize()...), keyID)
 }
 
 func (c *Conversation) calcXb(key *akeKeys, mb []byte) ([]byte, error) {
-	xb := c.ourCurrentKey.PublicKey().serialize()
+	xb := c.ourCurrentKey.PublicKey().Serialize()
 	xb = AppendWord(xb, c.ake.keys.ourKeyID)
 
 	sigb, err := c.ourCurrentKey.Sign(c.rand(), mb)
@@ -201,6 +207,10 @@ func (c *Conversation) sigMessage() ([]byte, error) {
 // processDHCommit = alice = y
 // Bob ---- DH Commit -----------> Alice
 func (c *Conversation) processDHCommit(msg []byte) error {
+	if err := c.contextErr(); err != nil {
+		return err
+	}
+
 	dhCommitMsg := dhCommit{}
 	err := dhCommitMsg.deserialize(msg)
 	if err != nil {
@@ -216,6 +226,10 @@ func (c *Conversation) processDHCommit(msg []byte) error {
 // processDHKey = bob = x
 // Alice -- DH Key --------------> Bob
 func (c *Conversation) processDHKey(msg []byte) (isSame bool, err error) {
+	if err = c.contextErr(); err != nil {
+		return
+	}
+
 	dhKeyMsg := dhKey{}
 	err = dhKeyMsg.deserialize(msg)
 	if err != nil {
@@ -239,6 +253,10 @@ func (c *Conversation) processDHKey(msg []byte) (isSame bool, err error) {
 // processRevealSig = alice = y
 // Bob ---- Reveal Signature ----> Alice
 func (c *Conversation) processRevealSig(msg []byte) (err error) {
+	if err = c.contextErr(); err != nil {
+		return
+	}
+
 	revealSigMsg := revealSig{}
 	err = revealSigMsg.deserialize(msg, c.version)
 	if err != nil {
@@ -262,7 +280,16 @@ func (c *Conversation) processRevealSig(msg []byte) (err error) {
 		return
 	}
 
+	if err = c.contextErr(); err != nil {
+		return
+	}
+
 	c.calcAKEKeys(c.calcDHSharedSecret())
+
+	if err = c.contextErr(); err != nil {
+		return
+	}
+
 	if err = c.processEncryptedSig(encryptedSig, theirMAC, &c.ake.revealKey); err != nil {
 		return newOtrError("in reveal signature message: " + err.Error())
 	}
@@ -273,6 +300,10 @@ func (c *Conversation) processRevealSig(msg []byte) (err error) {
 // processSig = bob = x
 // Alice -- Signature -----------> Bob
 func (c *Conversation) processSig(msg []byte) (err error) {
+	if err = c.contextErr(); err != nil {
+		return
+	}
+
 	sigMsg := sig{}
 	err = sigMsg.deserialize(msg)
 	if err != nil {
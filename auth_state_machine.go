@@ -12,14 +12,22 @@ func (c *Conversation) generateNewDHKeyPair() error {
 func (c *Conversation) akeHasFinished() error {
 	c.keys.wipe()
 	c.keys = c.ake.keys
+	c.keys.receiveWindow.size = c.receiveWindowSize
+	c.ssid = c.ake.ssid
+	c.metricsForAKEFinished()
 	c.ake.wipe(false)
 
 	previousMsgState := c.msgState
 	c.lastMessageStateChange = time.Now()
 	c.msgState = encrypted
+	defer c.signalTrustLevel()
 	defer c.signalSecurityEventIf(previousMsgState != encrypted, GoneSecure)
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, StillSecure)
 
+	if c.logger != nil && c.theirKey != nil {
+		c.logInfo("AKE finished", "version", c.version.protocolVersion(), "their_fingerprint", FormatFingerprint(c.theirKey.Fingerprint()))
+	}
+
 	if c.ourCurrentKey.PublicKey().IsSame(c.theirKey) {
 		c.messageEvent(MessageEventMessageReflected)
 	}
@@ -29,6 +37,7 @@ func (c *Conversation) akeHasFinished() error {
 
 func (c *Conversation) processAKE(msgType byte, msg []byte) (toSend []messageWithHeader, err error) {
 	c.ensureAKE()
+	before := c.akeStateName()
 
 	var toSendSingle messageWithHeader
 	var toSendExtra []messageWithHeader
@@ -48,7 +57,12 @@ func (c *Conversation) processAKE(msgType byte, msg []byte) (toSend []messageWit
 		err = newOtrErrorf("unknown message type 0x%X", msgType)
 	}
 
+	if isContextError(err) {
+		c.abortAKEForContext()
+	}
+
 	c.ake.lastStateChange = time.Now()
+	c.logDebug("AKE transition", "message", akeMessageName(msgType), "from", before, "to", c.akeStateName())
 
 	messages := append([]messageWithHeader{toSendSingle}, toSendExtra...)
 	toSend = compactMessagesWithHeader(messages...)
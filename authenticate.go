@@ -11,6 +11,7 @@ func (c *Conversation) StartAuthenticate(question string, mutualSecret []byte) (
 	if err != nil {
 		return nil, err
 	}
+	c.logDebug("SMP started", "to", c.smpStateName(), "has_question", question != "")
 
 	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, tlvs)
 	return msgs, err
@@ -31,6 +32,7 @@ func (c *Conversation) ProvideAuthenticationSecret(mutualSecret []byte) ([]Valid
 // AbortAuthentication should be called when the user wants to abort authentication with a peer.
 // It will return an SMP abort message to send.
 func (c *Conversation) AbortAuthentication() ([]ValidMessage, error) {
+	c.finishSMPSession(SMPResultAborted)
 	t := c.restartSMP()
 
 	msgs, _, err := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{t})
@@ -0,0 +1,57 @@
+package otr3
+
+import "context"
+
+// SendContext works like Send, but gives up as soon as the context is done
+func (c *Conversation) SendContext(ctx context.Context, m ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.ctx = ctx
+	defer func() { c.ctx = nil }()
+
+	return c.Send(m, trace...)
+}
+
+// ReceiveContext works like Receive, but checks the context between the expensive steps of the AKE and SMP.
+// If the context is done, the AKE or SMP in progress is aborted and its secrets are wiped. An aborted AKE returns the error
+// from the context. An aborted SMP sends an abort to the peer and signals SMPEventAbort, but the message carrying it is
+// otherwise received as usual, so its plain text isn't lost.
+func (c *Conversation) ReceiveContext(ctx context.Context, m ValidMessage) (MessagePlaintext, []ValidMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	c.ctx = ctx
+	defer func() { c.ctx = nil }()
+
+	return c.Receive(m)
+}
+
+// contextErr returns the error of the context given to SendContext or ReceiveContext, if it is done
+func (c *Conversation) contextErr() error {
+	if c.ctx == nil {
+		return nil
+	}
+	return c.ctx.Err()
+}
+
+func isContextError(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
+
+func (c *Conversation) abortAKEForContext() {
+	c.logDebug("AKE aborted", "from", c.akeStateName())
+	c.ake.wipe(true)
+	c.initAKE()
+}
+
+// abortSMPForContext aborts the SMP the same way as when it goes wrong: the peer is sent an abort, SMPEventAbort is signaled,
+// and the rest of the message that carried the SMP step is received as usual
+func (c *Conversation) abortSMPForContext() (smpState, smpMessage, error) {
+	c.logDebug("SMP aborted", "from", c.smpStateName())
+	c.smp.wipe()
+	c.smpEvent(SMPEventAbort, 0)
+	return sendSMPAbortAndRestartStateMachine()
+}
@@ -0,0 +1,140 @@
+package otr3
+
+import (
+	"context"
+	"testing"
+)
+
+// countdownContext is not done for the first checks, and then cancelled
+type countdownContext struct {
+	context.Context
+	checks int
+}
+
+func (c *countdownContext) Err() error {
+	if c.checks > 0 {
+		c.checks--
+		return nil
+	}
+	return context.Canceled
+}
+
+func cancelledAfter(checks int) context.Context {
+	return &countdownContext{context.Background(), checks}
+}
+
+func Test_ReceiveContext_doesNothingIfTheContextIsAlreadyDone(t *testing.T) {
+	c := &Conversation{Policies: PolicyManual}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	plain, toSend, err := c.ReceiveContext(ctx, ValidMessage("hello"))
+	assertNil(t, plain)
+	assertNil(t, toSend)
+	assertEquals(t, err, context.Canceled)
+}
+
+func Test_SendContext_doesNothingIfTheContextIsAlreadyDone(t *testing.T) {
+	c := &Conversation{Policies: PolicyManual}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	toSend, err := c.SendContext(ctx, ValidMessage("hello"))
+	assertNil(t, toSend)
+	assertEquals(t, err, context.Canceled)
+}
+
+func Test_SendContext_sendsTheMessage(t *testing.T) {
+	c := &Conversation{Policies: PolicyManual}
+
+	toSend, err := c.SendContext(context.Background(), ValidMessage("hello"))
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("hello")})
+	assertNil(t, c.ctx)
+}
+
+func Test_ReceiveContext_abortsTheAKEAndWipesItsSecrets(t *testing.T) {
+	alice, bob := fixtureConversationPair()
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+	assertNotNil(t, alice.ake.secretExponent)
+
+	_, toSend, err := alice.ReceiveContext(cancelledAfter(2), revealSig[0])
+	assertEquals(t, err, context.Canceled)
+	assertNil(t, toSend)
+	assertFalse(t, alice.IsEncrypted())
+	assertEquals(t, alice.ake.state, authState(authStateNone{}))
+	assertNil(t, alice.ake.secretExponent)
+	assertNil(t, alice.ake.theirPublicValue)
+	assertNil(t, alice.ctx)
+}
+
+func Test_ReceiveContext_abortsTheAKEWhenReceivingTheDHKey(t *testing.T) {
+	alice, bob := fixtureConversationPair()
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	assertNotNil(t, bob.ake.secretExponent)
+
+	_, toSend, err := bob.ReceiveContext(cancelledAfter(1), dhKey[0])
+	assertEquals(t, err, context.Canceled)
+	assertNil(t, toSend)
+	assertEquals(t, bob.ake.state, authState(authStateNone{}))
+	assertNil(t, bob.ake.secretExponent)
+	assertNil(t, bob.ake.theirPublicValue)
+}
+
+func Test_ReceiveContext_abortsTheAKEWhenReceivingTheSignature(t *testing.T) {
+	alice, bob := fixtureConversationPair()
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+	_, sig, _ := alice.Receive(revealSig[0])
+	assertTrue(t, alice.IsEncrypted())
+
+	_, toSend, err := bob.ReceiveContext(cancelledAfter(1), sig[0])
+	assertEquals(t, err, context.Canceled)
+	assertNil(t, toSend)
+	assertFalse(t, bob.IsEncrypted())
+	assertEquals(t, bob.ake.state, authState(authStateNone{}))
+	assertNil(t, bob.ake.secretExponent)
+}
+
+func Test_ReceiveContext_abortsTheSMPAndKeepsThePlainText(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	var aliceEvents, bobEvents []SMPEvent
+	alice.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) { aliceEvents = append(aliceEvents, e) }}
+	bob.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) { bobEvents = append(bobEvents, e) }}
+
+	session, toSend, err := alice.StartAuthenticateSession("", []byte("our secret"))
+	assertNil(t, err)
+	_, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+	smp2, err := bob.continueSMP([]byte("our secret"))
+	assertNil(t, err)
+	msg, _, err := bob.createSerializedDataMessage([]byte("hello"), 0, []tlv{*smp2})
+	assertNil(t, err)
+
+	plain, toSend, err := alice.ReceiveContext(cancelledAfter(2), msg[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertDeepEquals(t, aliceEvents, []SMPEvent{SMPEventAbort})
+	assertEquals(t, alice.smp.state, smpState(smpStateExpect1{}))
+	assertNil(t, alice.smp.secret)
+	assertNil(t, alice.smp.s1)
+
+	select {
+	case <-session.Done():
+	default:
+		t.Errorf("expected the SMP session to be finished")
+	}
+
+	assertEquals(t, len(toSend), 1)
+	_, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertEquals(t, bob.smp.state, smpState(smpStateExpect1{}))
+	assertEquals(t, bobEvents[len(bobEvents)-1], SMPEventAbort)
+}
@@ -1,6 +1,7 @@
 package otr3
 
 import (
+	"context"
 	"io"
 	"time"
 )
@@ -20,7 +21,7 @@ var (
 )
 
 // Conversation contains all the information for a specific connection between two peers in an IM system.
-// Policies are not supposed to change once a conversation has been used
+// Policies can be changed between messages, or decided for every message by a PolicyResolver
 type Conversation struct {
 	version otrVersion
 	Rand    io.Reader
@@ -41,13 +42,16 @@ type Conversation struct {
 	ake        *ake
 	smp        smp
 	keys       keyManagementContext
-	Policies   policies
+	Policies   Policy
 	heartbeat  heartbeatContext
 	resend     resendContext
 	injections injections
 
-	fragmentSize         uint16
-	fragmentationContext fragmentationContext
+	fragmentSize   uint16
+	maxMessageSize MaxMessageSizeFunc
+	fragments      fragmentReassembly
+
+	receiveWindowSize int
 
 	smpEventHandler      SMPEventHandler
 	errorMessageHandler  ErrorMessageHandler
@@ -55,6 +59,14 @@ type Conversation struct {
 	securityEventHandler SecurityEventHandler
 	receivedKeyHandler   ReceivedKeyHandler
 
+	trust          trustContext
+	instanceTags   instanceTagContext
+	policyResolver policyResolverContext
+	logger         Logger
+	metrics        Metrics
+
+	ctx context.Context
+
 	debug         bool
 	sentRevealSig bool
 
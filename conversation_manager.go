@@ -0,0 +1,246 @@
+package otr3
+
+import (
+	"math/big"
+	"time"
+)
+
+// InstanceSelection decides which peer instance a ConversationManager should pick when
+// more than one instance of the same peer is available
+type InstanceSelection int
+
+const (
+	// MasterInstance selects the conversation that is not bound to any specific instance of the peer.
+	// This is the conversation used for query messages, plaintext and OTR version 2.
+	MasterInstance InstanceSelection = iota
+	// MostRecentInstance selects the instance we most recently received a message from
+	MostRecentInstance
+	// BestInstance selects the instance with the most secure message state, using the most recent one to break ties
+	BestInstance
+)
+
+type managedPeer struct {
+	account, peer string
+}
+
+type managedInstance struct {
+	c            *Conversation
+	lastReceived time.Time
+}
+
+type managedConversations struct {
+	master    *Conversation
+	instances map[uint32]*managedInstance
+}
+
+// ConversationManager keeps one Conversation for every instance of a peer we talk to from a specific account.
+// Incoming messages are routed to the correct instance using the instance tags in the message, and
+// conversations for new instances are created from the master conversation of that peer, sharing
+// our keys, instance tag, policies and event handlers.
+//
+// A ConversationManager is not safe for concurrent use - calls to it, and to the conversations it returns, have to be serialized.
+type ConversationManager struct {
+	newConversation func(account, peer string) *Conversation
+	peers           map[managedPeer]*managedConversations
+}
+
+// NewConversationManager creates a new ConversationManager. The given function will be called once
+// for each account and peer combination to create the master conversation for that peer.
+func NewConversationManager(newConversation func(account, peer string) *Conversation) *ConversationManager {
+	return &ConversationManager{
+		newConversation: newConversation,
+		peers:           make(map[managedPeer]*managedConversations),
+	}
+}
+
+func (m *ConversationManager) conversationsFor(account, peer string) *managedConversations {
+	k := managedPeer{account, peer}
+	cs, ok := m.peers[k]
+	if !ok {
+		cs = &managedConversations{
+			master:    m.newConversation(account, peer),
+			instances: make(map[uint32]*managedInstance),
+		}
+		m.peers[k] = cs
+	}
+	return cs
+}
+
+// Master returns the master conversation for the given account and peer, creating it if necessary
+func (m *ConversationManager) Master(account, peer string) *Conversation {
+	return m.conversationsFor(account, peer).master
+}
+
+// Instance returns the conversation for the given instance of the peer, or nil if we have never received a message from that instance
+func (m *ConversationManager) Instance(account, peer string, theirInstanceTag uint32) *Conversation {
+	if in, ok := m.conversationsFor(account, peer).instances[theirInstanceTag]; ok {
+		return in.c
+	}
+	return nil
+}
+
+// Instances returns the conversations for all known instances of the peer, not including the master conversation
+func (m *ConversationManager) Instances(account, peer string) []*Conversation {
+	var result []*Conversation
+	for _, in := range m.conversationsFor(account, peer).instances {
+		result = append(result, in.c)
+	}
+	return result
+}
+
+// Select returns the conversation for the given account and peer that matches the selection.
+// If no instances of the peer are known, the master conversation is returned.
+func (m *ConversationManager) Select(account, peer string, s InstanceSelection) *Conversation {
+	cs := m.conversationsFor(account, peer)
+
+	var selected *managedInstance
+	for _, in := range cs.instances {
+		switch s {
+		case MostRecentInstance:
+			if selected == nil || in.lastReceived.After(selected.lastReceived) {
+				selected = in
+			}
+		case BestInstance:
+			if selected == nil || in.isBetterThan(selected) {
+				selected = in
+			}
+		}
+	}
+
+	if selected == nil {
+		return cs.master
+	}
+	return selected.c
+}
+
+// Send sends the message to the instance of the peer that matches the selection
+func (m *ConversationManager) Send(account, peer string, s InstanceSelection, msg ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
+	return m.Select(account, peer, s).Send(msg, trace...)
+}
+
+// Receive routes a message received from the peer to the conversation for the sending instance, and returns that conversation
+// together with the result of receiving the message on it
+func (m *ConversationManager) Receive(account, peer string, msg ValidMessage) (*Conversation, MessagePlaintext, []ValidMessage, error) {
+	cs := m.conversationsFor(account, peer)
+
+	ours, theirs, ok := ExtractInstanceTags(msg)
+	if !ok || theirs < minValidInstanceTag {
+		plain, toSend, err := cs.master.Receive(msg)
+		return cs.master, plain, toSend, err
+	}
+
+	if ours != 0 && ours != cs.master.GetOurInstanceTag() {
+		cs.master.messageEvent(MessageEventReceivedMessageForOtherInstance)
+		return cs.master, nil, nil, nil
+	}
+
+	in, ok := cs.instances[theirs]
+	if !ok {
+		in = &managedInstance{c: cs.master.newInstanceConversation(theirs)}
+		cs.instances[theirs] = in
+	}
+	in.lastReceived = time.Now()
+
+	if guessMessageType(msg) == msgGuessDHKey {
+		in.c.takeOverAKEFrom(cs.master)
+	}
+
+	plain, toSend, err := in.c.Receive(msg)
+	return in.c, plain, toSend, err
+}
+
+func (in *managedInstance) isBetterThan(other *managedInstance) bool {
+	r1, r2 := in.c.msgState.securityRank(), other.c.msgState.securityRank()
+	if r1 != r2 {
+		return r1 > r2
+	}
+	return in.lastReceived.After(other.lastReceived)
+}
+
+func (m msgState) securityRank() int {
+	switch m {
+	case encrypted:
+		return 2
+	case finished:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// newInstanceConversation creates a conversation bound to the given instance of the peer,
+// sharing everything the master conversation knows about us
+func (c *Conversation) newInstanceConversation(theirInstanceTag uint32) *Conversation {
+	ret := &Conversation{
+		version:          c.version,
+		Rand:             c.Rand,
+		Policies:         c.Policies,
+		ourKeys:          c.ourKeys,
+		ourCurrentKey:    c.ourCurrentKey,
+		ourInstanceTag:   c.GetOurInstanceTag(),
+		theirInstanceTag: theirInstanceTag,
+
+		fragmentSize:      c.fragmentSize,
+		maxMessageSize:    c.maxMessageSize,
+		receiveWindowSize: c.receiveWindowSize,
+
+		smpEventHandler:      c.smpEventHandler,
+		errorMessageHandler:  c.errorMessageHandler,
+		messageEventHandler:  c.messageEventHandler,
+		securityEventHandler: c.securityEventHandler,
+		receivedKeyHandler:   c.receivedKeyHandler,
+
+		trust:          c.trust,
+		instanceTags:   c.instanceTags,
+		policyResolver: c.policyResolver,
+		logger:         c.logger,
+		metrics:        c.metrics,
+
+		debug:                c.debug,
+		friendlyQueryMessage: c.friendlyQueryMessage,
+	}
+	ret.resend.messageTransform = c.resend.messageTransform
+	ret.resend.expiry = c.resend.expiry
+	ret.resend.maxQueued = c.resend.maxQueued
+	ret.heartbeat.policy = c.heartbeat.policy
+	ret.heartbeat.interval = c.heartbeat.interval
+	ret.fragments.maxSize = c.fragments.maxSize
+	ret.fragments.budget = c.fragments.budget
+	ret.fragments.expiry = c.fragments.expiry
+
+	ret.takeOverAKEFrom(c)
+
+	return ret
+}
+
+// takeOverAKEFrom gives the instance conversation a copy of the AKE the master conversation is running, if the master
+// is waiting for a D-H Key and the instance isn't running an AKE of its own. A D-H Commit sent from the master conversation
+// is addressed to all instances of the peer, so every instance answering it needs its own copy of the AKE in progress.
+func (c *Conversation) takeOverAKEFrom(master *Conversation) {
+	if master.ake == nil || master.ake.state != (authStateAwaitingDHKey{}) {
+		return
+	}
+
+	if c.ake != nil {
+		switch c.ake.state.(type) {
+		case authStateAwaitingDHKey, authStateAwaitingRevealSig, authStateAwaitingSig:
+			return
+		}
+	}
+
+	c.ake = master.ake.copyAwaitingDHKey()
+}
+
+func (a *ake) copyAwaitingDHKey() *ake {
+	ret := &ake{
+		secretExponent:  createSecretKeyValue(a.secretExponent),
+		ourPublicValue:  new(big.Int).Set(a.ourPublicValue),
+		r:               a.r,
+		encryptedGx:     makeCopy(a.encryptedGx),
+		state:           authStateAwaitingDHKey{},
+		lastStateChange: a.lastStateChange,
+		started:         a.started,
+	}
+	ret.keys.ourKeyID = a.keys.ourKeyID
+	return ret
+}
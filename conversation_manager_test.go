@@ -0,0 +1,160 @@
+package otr3
+
+import "testing"
+
+func newTestConversationManager(tag uint32) *ConversationManager {
+	return NewConversationManager(func(account, peer string) *Conversation {
+		return fixtureConversationWithInstanceTag(alicePrivateKey, tag)
+	})
+}
+
+func Test_ConversationManager_Master_returnsTheSameConversationForTheSamePeer(t *testing.T) {
+	m := newTestConversationManager(0x1000)
+	c1 := m.Master("alice@example.org", "bob@example.org")
+	c2 := m.Master("alice@example.org", "bob@example.org")
+	c3 := m.Master("alice@example.org", "carol@example.org")
+
+	assertEquals(t, c1, c2)
+	assertNotEquals(t, c1, c3)
+}
+
+func Test_ConversationManager_Receive_routesUntaggedMessagesToTheMaster(t *testing.T) {
+	m := newTestConversationManager(0x1000)
+
+	c, plain, _, err := m.Receive("alice", "bob", ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertEquals(t, c, m.Master("alice", "bob"))
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, len(m.Instances("alice", "bob")), 0)
+}
+
+func Test_ConversationManager_Receive_createsAnInstanceForTaggedMessages(t *testing.T) {
+	m := newTestConversationManager(0x1000)
+	bob := fixtureConversationWithInstanceTag(bobPrivateKey, 0x2000)
+
+	_, toSend, _ := bob.Receive(m.Master("alice", "bob").QueryMessage())
+	c, _, _, err := m.Receive("alice", "bob", toSend[0])
+
+	assertNil(t, err)
+	assertNotEquals(t, c, m.Master("alice", "bob"))
+	assertEquals(t, c, m.Instance("alice", "bob", 0x2000))
+	assertEquals(t, c.GetOurInstanceTag(), uint32(0x1000))
+	assertEquals(t, c.GetTheirInstanceTag(), uint32(0x2000))
+	assertEquals(t, c.ake.state, authStateAwaitingRevealSig{})
+}
+
+func Test_ConversationManager_Receive_ignoresMessagesForOtherInstancesOfUs(t *testing.T) {
+	m := newTestConversationManager(0x1000)
+	bob := fixtureConversationWithInstanceTag(bobPrivateKey, 0x2000)
+	bob.theirInstanceTag = 0x3000
+
+	_, toSend, _ := bob.Receive(ValidMessage("?OTRv3?"))
+
+	m.Master("alice", "bob").expectMessageEvent(t, func() {
+		c, plain, ts, err := m.Receive("alice", "bob", toSend[0])
+		assertEquals(t, c, m.Master("alice", "bob"))
+		assertNil(t, plain)
+		assertNil(t, ts)
+		assertNil(t, err)
+	}, MessageEventReceivedMessageForOtherInstance, nil, nil)
+
+	assertNil(t, m.Instance("alice", "bob", 0x2000))
+}
+
+func Test_ConversationManager_completesAKEWithSeveralInstancesOfThePeer(t *testing.T) {
+	m := newTestConversationManager(0x1000)
+	bob1 := fixtureConversationWithInstanceTag(bobPrivateKey, 0x2000)
+	bob2 := fixtureConversationWithInstanceTag(bobPrivateKey, 0x3000)
+
+	master := m.Master("alice", "bob")
+	_, _ = master.Send(ValidMessage("?OTRv3?"))
+	_, dhCommit, err := master.Receive(ValidMessage("?OTRv3?"))
+	assertNil(t, err)
+
+	for _, bob := range []*Conversation{bob1, bob2} {
+		_, toSend, e := bob.Receive(dhCommit[0])
+		assertNil(t, e)
+
+		for len(toSend) > 0 {
+			var c *Conversation
+			c, _, toSend, e = m.Receive("alice", "bob", toSend[0])
+			assertNil(t, e)
+			assertEquals(t, c.GetTheirInstanceTag(), bob.GetOurInstanceTag())
+			if len(toSend) > 0 {
+				_, toSend, e = bob.Receive(toSend[0])
+				assertNil(t, e)
+			}
+		}
+		assertTrue(t, bob.IsEncrypted())
+	}
+
+	assertTrue(t, m.Instance("alice", "bob", 0x2000).IsEncrypted())
+	assertTrue(t, m.Instance("alice", "bob", 0x3000).IsEncrypted())
+	assertFalse(t, master.IsEncrypted())
+	assertEquals(t, m.Select("alice", "bob", MostRecentInstance), m.Instance("alice", "bob", 0x3000))
+
+	msg, err := m.Send("alice", "bob", BestInstance, ValidMessage("hello"))
+	assertNil(t, err)
+
+	plain, _, err := bob2.Receive(msg[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
+
+func Test_ConversationManager_completesAnAKEStartedByTheMasterWithAnInstanceThatAlreadyExists(t *testing.T) {
+	m := newTestConversationManager(0x1000)
+	bob := fixtureConversationWithInstanceTag(bobPrivateKey, 0x2000)
+	master := m.Master("alice", "bob")
+
+	exchangeWithManager := func(toSend []ValidMessage) {
+		for len(toSend) > 0 {
+			_, toBob, e := bob.Receive(toSend[0])
+			assertNil(t, e)
+			toSend = nil
+			if len(toBob) > 0 {
+				_, _, toSend, e = m.Receive("alice", "bob", toBob[0])
+				assertNil(t, e)
+			}
+		}
+	}
+
+	_, dhCommit, err := master.Receive(ValidMessage("?OTRv3?"))
+	assertNil(t, err)
+	exchangeWithManager(dhCommit)
+	instance := m.Instance("alice", "bob", 0x2000)
+	assertTrue(t, instance.IsEncrypted())
+	ssid := instance.GetSSID()
+
+	dhCommit, err = master.StartAKE(3)
+	assertNil(t, err)
+	exchangeWithManager(dhCommit)
+
+	assertEquals(t, m.Instance("alice", "bob", 0x2000), instance)
+	assertTrue(t, bob.IsEncrypted())
+	assertEquals(t, bob.GetSSID(), instance.GetSSID())
+	assertNotEquals(t, instance.GetSSID(), ssid)
+}
+
+func Test_ConversationManager_Select_returnsTheMasterWhenNoInstancesAreKnown(t *testing.T) {
+	m := newTestConversationManager(0x1000)
+
+	assertEquals(t, m.Select("alice", "bob", MasterInstance), m.Master("alice", "bob"))
+	assertEquals(t, m.Select("alice", "bob", MostRecentInstance), m.Master("alice", "bob"))
+	assertEquals(t, m.Select("alice", "bob", BestInstance), m.Master("alice", "bob"))
+}
+
+func Test_ConversationManager_Select_prefersEncryptedInstancesForBest(t *testing.T) {
+	m := newTestConversationManager(0x1000)
+	cs := m.conversationsFor("alice", "bob")
+
+	older := &managedInstance{c: cs.master.newInstanceConversation(0x2000)}
+	older.c.msgState = encrypted
+	newer := &managedInstance{c: cs.master.newInstanceConversation(0x3000)}
+	newer.lastReceived = older.lastReceived.Add(1)
+	cs.instances[0x2000] = older
+	cs.instances[0x3000] = newer
+
+	assertEquals(t, m.Select("alice", "bob", BestInstance), older.c)
+	assertEquals(t, m.Select("alice", "bob", MostRecentInstance), newer.c)
+}
@@ -0,0 +1,372 @@
+package otr3
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"time"
+)
+
+var conversationStateMagic = []byte("OTR3-CONVERSATION-STATE")
+
+const conversationStateVersion = uint16(1)
+
+var errCorruptConversationState = newOtrError("corrupt conversation state")
+var errUnsupportedConversationStateVersion = newOtrError("unsupported conversation state version")
+var errNoMatchingKeyForConversationState = newOtrError("none of our keys match the key used in the conversation state")
+
+func conversationStateHeader(v uint16) []byte {
+	return AppendShort(makeCopy(conversationStateMagic), v)
+}
+
+// ExportState writes the current state of the conversation to w, so that it can be resumed later using ImportConversationState.
+// The state is encrypted and authenticated with a key derived from the passphrase.
+// It contains the message state, the session keys, counters, the SSID, the key of the peer and all messages waiting to be resent.
+// Our long term private keys, the event handlers and any AKE or SMP in progress are not part of the exported state.
+// Neither are the keys kept by the receive window or the counters remembered to detect replays, so messages sent before
+// the export that arrive after the import are rejected, even with a receive window.
+func (c *Conversation) ExportState(w io.Writer, passphrase []byte) error {
+	plain := c.serializeState()
+	defer wipeBytes(plain)
+
+	header := conversationStateHeader(conversationStateVersion)
+	sealed, err := sealWithPassphrase(c.rand(), header, passphrase, plain)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(header, sealed...))
+	return err
+}
+
+// ImportConversationState reads a conversation state written by ExportState and returns a new conversation in that state.
+// The given keys will be set as our keys for the conversation, and one of them has to be the key that was in use when the state was exported.
+// Event handlers and other settings not included in the state have to be set again on the returned conversation.
+func ImportConversationState(r io.Reader, passphrase []byte, ourKeys []PrivateKey) (*Conversation, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header := conversationStateHeader(conversationStateVersion)
+	if !bytes.HasPrefix(data, conversationStateMagic) || len(data) < len(header) {
+		return nil, errCorruptConversationState
+	}
+
+	if !bytes.Equal(data[:len(header)], header) {
+		return nil, errUnsupportedConversationStateVersion
+	}
+
+	plain, rest, err := openWithPassphrase(header, passphrase, data[len(header):])
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(plain)
+
+	if len(rest) > 0 {
+		return nil, errCorruptConversationState
+	}
+
+	c := &Conversation{}
+	c.SetOurKeys(ourKeys)
+	if err := c.deserializeState(plain); err != nil {
+		c.keys.wipe()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func appendTime(l []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return AppendLong(l, 0)
+	}
+	return AppendLong(l, uint64(t.Unix()))
+}
+
+func extractTime(d []byte) ([]byte, time.Time, bool) {
+	rest, v, ok := ExtractLong(d)
+	if !ok || v == 0 {
+		return rest, time.Time{}, ok
+	}
+	return rest, time.Unix(int64(v), 0), true
+}
+
+func appendOptionalMPI(l []byte, v *big.Int) []byte {
+	if v == nil {
+		return append(l, 0x00)
+	}
+	return AppendMPI(append(l, 0x01), v)
+}
+
+func extractOptionalMPI(d []byte) ([]byte, *big.Int, bool) {
+	rest, present, ok := ExtractByte(d)
+	if !ok || present == 0x00 {
+		return rest, nil, ok
+	}
+	return ExtractMPI(rest)
+}
+
+func appendPublicKey(l []byte, k PublicKey) []byte {
+	if k == nil {
+		return AppendData(l, nil)
+	}
+	return AppendData(l, k.Serialize())
+}
+
+func appendDHKeyPair(l []byte, k dhKeyPair) []byte {
+	return appendOptionalMPI(AppendData(l, k.priv), k.pub)
+}
+
+func extractDHKeyPair(d []byte) ([]byte, dhKeyPair, bool) {
+	var ret dhKeyPair
+	rest, priv, ok1 := ExtractData(d)
+	rest, pub, ok2 := extractOptionalMPI(rest)
+	ret.pub = pub
+	if len(priv) > 0 {
+		ret.priv = createSecretKeyValue(priv)
+	}
+	return rest, ret, ok1 && ok2
+}
+
+func (k *keyManagementContext) serialize(out []byte) []byte {
+	out = AppendWord(out, k.ourKeyID)
+	out = AppendWord(out, k.theirKeyID)
+	out = appendDHKeyPair(out, k.ourCurrentDHKeys)
+	out = appendDHKeyPair(out, k.ourPreviousDHKeys)
+	out = appendOptionalMPI(out, k.theirCurrentDHPubKey)
+	out = appendOptionalMPI(out, k.theirPreviousDHPubKey)
+
+	out = AppendWord(out, uint32(len(k.counterHistory.counters)))
+	for _, ctr := range k.counterHistory.counters {
+		out = AppendWord(out, ctr.ourKeyID)
+		out = AppendWord(out, ctr.theirKeyID)
+		out = AppendLong(out, ctr.ourCounter)
+		out = AppendLong(out, ctr.theirCounter)
+	}
+
+	out = AppendWord(out, uint32(len(k.macKeyHistory.items)))
+	for _, item := range k.macKeyHistory.items {
+		out = AppendWord(out, item.ourKeyID)
+		out = AppendWord(out, item.theirKeyID)
+		out = AppendData(out, item.receivingKey)
+	}
+
+	out = AppendWord(out, uint32(len(k.oldMACKeys)))
+	for _, mk := range k.oldMACKeys {
+		out = AppendData(out, mk)
+	}
+
+	return out
+}
+
+func (k *keyManagementContext) deserialize(d []byte) ([]byte, bool) {
+	var ok [8]bool
+	d, k.ourKeyID, ok[0] = ExtractWord(d)
+	d, k.theirKeyID, ok[1] = ExtractWord(d)
+	d, k.ourCurrentDHKeys, ok[2] = extractDHKeyPair(d)
+	d, k.ourPreviousDHKeys, ok[3] = extractDHKeyPair(d)
+	d, k.theirCurrentDHPubKey, ok[4] = extractOptionalMPI(d)
+	d, k.theirPreviousDHPubKey, ok[5] = extractOptionalMPI(d)
+	for _, v := range ok[:6] {
+		if !v {
+			return nil, false
+		}
+	}
+
+	var n uint32
+	if d, n, ok[6] = ExtractWord(d); !ok[6] {
+		return nil, false
+	}
+	for i := uint32(0); i < n; i++ {
+		ctr := &keyPairCounter{}
+		var ok1, ok2, ok3, ok4 bool
+		d, ctr.ourKeyID, ok1 = ExtractWord(d)
+		d, ctr.theirKeyID, ok2 = ExtractWord(d)
+		d, ctr.ourCounter, ok3 = ExtractLong(d)
+		d, ctr.theirCounter, ok4 = ExtractLong(d)
+		if !(ok1 && ok2 && ok3 && ok4) {
+			return nil, false
+		}
+		k.counterHistory.counters = append(k.counterHistory.counters, ctr)
+		// The replay cache isn't exported, so no message from before the export can be accepted late
+		k.replays.forgetUpTo(keyIDPair{ctr.ourKeyID, ctr.theirKeyID}, ctr.theirCounter)
+	}
+
+	if d, n, ok[7] = ExtractWord(d); !ok[7] {
+		return nil, false
+	}
+	for i := uint32(0); i < n; i++ {
+		var item macKeyUsage
+		var ok1, ok2, ok3 bool
+		var key []byte
+		d, item.ourKeyID, ok1 = ExtractWord(d)
+		d, item.theirKeyID, ok2 = ExtractWord(d)
+		d, key, ok3 = ExtractData(d)
+		if !(ok1 && ok2 && ok3) {
+			return nil, false
+		}
+		item.receivingKey = makeCopy(key)
+		k.macKeyHistory.items = append(k.macKeyHistory.items, item)
+	}
+
+	var ok1 bool
+	if d, n, ok1 = ExtractWord(d); !ok1 {
+		return nil, false
+	}
+	for i := uint32(0); i < n; i++ {
+		var key []byte
+		if d, key, ok1 = ExtractData(d); !ok1 {
+			return nil, false
+		}
+		k.oldMACKeys = append(k.oldMACKeys, makeCopy(key))
+	}
+
+	return d, true
+}
+
+func (c *Conversation) serializeState() []byte {
+	var out []byte
+
+	if c.version != nil {
+		out = AppendShort(out, c.version.protocolVersion())
+	} else {
+		out = AppendShort(out, 0)
+	}
+
+	out = AppendWord(out, uint32(c.Policies))
+	out = append(out, byte(c.msgState), byte(c.whitespaceState))
+	out = appendTime(out, c.lastMessageStateChange)
+	out = AppendWord(out, c.ourInstanceTag)
+	out = AppendWord(out, c.theirInstanceTag)
+	out = append(out, c.ssid[:]...)
+
+	if c.ourCurrentKey != nil {
+		out = appendPublicKey(out, c.ourCurrentKey.PublicKey())
+	} else {
+		out = appendPublicKey(out, nil)
+	}
+	out = appendPublicKey(out, c.theirKey)
+
+	out = c.keys.serialize(out)
+
+	out = appendTime(out, c.heartbeat.lastSent)
+	out = append(out, byte(c.resend.mayRetransmit))
+	pending := c.resend.pending()
+	out = AppendWord(out, uint32(len(pending)))
+	for _, m := range pending {
+		out = AppendData(out, m.m)
+	}
+
+	return AppendShort(out, c.fragmentSize)
+}
+
+func (c *Conversation) deserializeVersion(v uint16) error {
+	switch v {
+	case 0:
+		c.version = nil
+	case 2:
+		c.version = otrV2{}
+	case 3:
+		c.version = otrV3{}
+	default:
+		return errUnsupportedOTRVersion
+	}
+	return nil
+}
+
+func (c *Conversation) deserializeOurCurrentKey(serialized []byte) error {
+	if len(serialized) == 0 {
+		return nil
+	}
+
+	for _, k := range c.ourKeys {
+		if bytes.Equal(k.PublicKey().Serialize(), serialized) {
+			c.ourCurrentKey = k
+			return nil
+		}
+	}
+
+	return errNoMatchingKeyForConversationState
+}
+
+func (c *Conversation) deserializeTheirKey(serialized []byte) error {
+	if len(serialized) == 0 {
+		return nil
+	}
+
+	_, ok, k := ParsePublicKey(serialized)
+	if !ok {
+		return errCorruptConversationState
+	}
+	c.theirKey = k
+	return nil
+}
+
+func (c *Conversation) deserializeState(d []byte) error {
+	var ok [14]bool
+	var v uint16
+	var pols uint32
+	var ms, ws, rt byte
+	var ssid, ourKey, theirKey []byte
+
+	d, v, ok[0] = ExtractShort(d)
+	d, pols, ok[1] = ExtractWord(d)
+	d, ms, ok[2] = ExtractByte(d)
+	d, ws, ok[3] = ExtractByte(d)
+	d, c.lastMessageStateChange, ok[4] = extractTime(d)
+	d, c.ourInstanceTag, ok[5] = ExtractWord(d)
+	d, c.theirInstanceTag, ok[6] = ExtractWord(d)
+	d, ssid, ok[7] = ExtractFixedData(d, len(c.ssid))
+	d, ourKey, ok[8] = ExtractData(d)
+	d, theirKey, ok[9] = ExtractData(d)
+	d, ok[10] = c.keys.deserialize(d)
+	d, c.heartbeat.lastSent, ok[11] = extractTime(d)
+	d, rt, ok[12] = ExtractByte(d)
+
+	for _, v := range ok[:13] {
+		if !v {
+			return errCorruptConversationState
+		}
+	}
+
+	var n uint32
+	if d, n, ok[13] = ExtractWord(d); !ok[13] {
+		return errCorruptConversationState
+	}
+	for i := uint32(0); i < n; i++ {
+		var m []byte
+		var ok1 bool
+		if d, m, ok1 = ExtractData(d); !ok1 {
+			return errCorruptConversationState
+		}
+		c.resend.later(MessagePlaintext(m))
+	}
+
+	rest, fragSize, ok1 := ExtractShort(d)
+	if !ok1 || len(rest) > 0 {
+		return errCorruptConversationState
+	}
+
+	if msgState(ms) > finished || whitespaceState(ws) > whitespaceRejected || retransmitFlag(rt) > retransmitExact {
+		return errCorruptConversationState
+	}
+
+	c.Policies = policies(pols)
+	c.msgState = msgState(ms)
+	c.whitespaceState = whitespaceState(ws)
+	c.resend.mayRetransmit = retransmitFlag(rt)
+	c.fragmentSize = fragSize
+	copy(c.ssid[:], ssid)
+
+	if err := c.deserializeVersion(v); err != nil {
+		return err
+	}
+
+	if err := c.deserializeTheirKey(theirKey); err != nil {
+		return err
+	}
+
+	return c.deserializeOurCurrentKey(ourKey)
+}
@@ -0,0 +1,149 @@
+package otr3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_sealWithPassphrase_canBeOpenedWithTheSamePassphraseAndHeader(t *testing.T) {
+	sealed, err := sealWithPassphrase(fixtureRand(), []byte("header"), []byte("secret"), []byte("hello world"))
+	assertNil(t, err)
+
+	plain, rest, err := openWithPassphrase([]byte("header"), []byte("secret"), append(sealed, 0x42))
+	assertNil(t, err)
+	assertDeepEquals(t, plain, []byte("hello world"))
+	assertDeepEquals(t, rest, []byte{0x42})
+
+	_, _, err = openWithPassphrase([]byte("header"), []byte("wrong"), sealed)
+	assertEquals(t, err, errWrongPassphrase)
+
+	_, _, err = openWithPassphrase([]byte("other header"), []byte("secret"), sealed)
+	assertEquals(t, err, errWrongPassphrase)
+}
+
+func Test_openWithPassphrase_rejectsTooManyIterations(t *testing.T) {
+	sealed, err := sealWithPassphrase(fixtureRand(), []byte("header"), []byte("secret"), []byte("hello world"))
+	assertNil(t, err)
+
+	tooMany := append(SerializeWord(maxPassphraseKDFIterations+1), sealed[4:]...)
+	_, _, err = openWithPassphrase([]byte("header"), []byte("secret"), tooMany)
+	assertEquals(t, err, errWrongPassphrase)
+}
+
+func Test_ExportState_andImportConversationState_resumeAnEncryptedConversation(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	assertTrue(t, alice.IsEncrypted())
+
+	msg, _ := alice.Send(ValidMessage("before"))
+	plain, _, err := bob.Receive(msg[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("before"))
+
+	var buf bytes.Buffer
+	assertNil(t, alice.ExportState(&buf, []byte("passphrase")))
+
+	resumed, err := ImportConversationState(&buf, []byte("passphrase"), []PrivateKey{bobPrivateKey, alicePrivateKey})
+	assertNil(t, err)
+	assertTrue(t, resumed.IsEncrypted())
+	assertEquals(t, resumed.version, otrV3{})
+	assertEquals(t, resumed.ourCurrentKey, alicePrivateKey)
+	assertTrue(t, bytes.Equal(resumed.theirKey.Fingerprint(), bobPrivateKey.PublicKey().Fingerprint()))
+	assertEquals(t, resumed.GetSSID(), alice.GetSSID())
+	assertEquals(t, resumed.GetOurInstanceTag(), alice.GetOurInstanceTag())
+	assertEquals(t, resumed.GetTheirInstanceTag(), alice.GetTheirInstanceTag())
+
+	msg, err = resumed.Send(ValidMessage("after"))
+	assertNil(t, err)
+	plain, _, err = bob.Receive(msg[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("after"))
+
+	msg, _ = bob.Send(ValidMessage("reply"))
+	plain, _, err = resumed.Receive(msg[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("reply"))
+}
+
+func Test_ExportState_keepsMessagesWaitingToBeResent(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = policies(allowV3 | requireEncryption)
+	_, _ = c.Send(ValidMessage("queued"))
+
+	var buf bytes.Buffer
+	assertNil(t, c.ExportState(&buf, []byte("passphrase")))
+
+	resumed, err := ImportConversationState(&buf, []byte("passphrase"), nil)
+	assertNil(t, err)
+	assertNil(t, resumed.version)
+	assertEquals(t, resumed.resend.mayRetransmit, retransmitExact)
+	assertEquals(t, len(resumed.resend.pending()), 1)
+	assertDeepEquals(t, resumed.resend.pending()[0].m, MessagePlaintext("queued"))
+}
+
+func Test_ImportConversationState_failsWithTheWrongPassphrase(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	var buf bytes.Buffer
+	_ = alice.ExportState(&buf, []byte("passphrase"))
+
+	_, err := ImportConversationState(&buf, []byte("wrong"), []PrivateKey{alicePrivateKey})
+	assertEquals(t, err, errWrongPassphrase)
+}
+
+func Test_ImportConversationState_failsWithoutTheKeyInUse(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+
+	var buf bytes.Buffer
+	_ = alice.ExportState(&buf, []byte("passphrase"))
+
+	_, err := ImportConversationState(&buf, []byte("passphrase"), []PrivateKey{bobPrivateKey})
+	assertEquals(t, err, errNoMatchingKeyForConversationState)
+}
+
+func Test_ImportConversationState_failsForUnknownFormats(t *testing.T) {
+	_, err := ImportConversationState(bytes.NewReader([]byte("hello")), []byte("passphrase"), nil)
+	assertEquals(t, err, errCorruptConversationState)
+
+	_, err = ImportConversationState(bytes.NewReader(conversationStateHeader(42)), []byte("passphrase"), nil)
+	assertEquals(t, err, errUnsupportedConversationStateVersion)
+}
+
+func Test_deserializeState_failsForUnknownStates(t *testing.T) {
+	c := &Conversation{}
+	// the message state comes after the version and the policies
+	msgStateAt := 2 + 4
+
+	state := c.serializeState()
+	assertNil(t, (&Conversation{}).deserializeState(state))
+
+	state[msgStateAt] = byte(finished + 1)
+	assertEquals(t, (&Conversation{}).deserializeState(state), errCorruptConversationState)
+
+	state = c.serializeState()
+	state[msgStateAt+1] = byte(whitespaceRejected + 1)
+	assertEquals(t, (&Conversation{}).deserializeState(state), errCorruptConversationState)
+}
+
+func Test_ImportConversationState_rejectsMessagesFromBeforeTheExport(t *testing.T) {
+	alice, bob := fixtureEncryptedConversationsWithReceiveWindow(4)
+	first := sendOne(t, alice, "first")
+	second := sendOne(t, alice, "second")
+	_, _, err := bob.Receive(second)
+	assertNil(t, err)
+
+	var buf bytes.Buffer
+	assertNil(t, bob.ExportState(&buf, []byte("passphrase")))
+	resumed, err := ImportConversationState(&buf, []byte("passphrase"), []PrivateKey{bobPrivateKey})
+	assertNil(t, err)
+	resumed.SetReceiveWindow(4)
+
+	for _, m := range []ValidMessage{first, second} {
+		plain, _, err := resumed.Receive(m)
+		assertEquals(t, err, newOtrConflictError("counter regressed"))
+		assertNil(t, plain)
+	}
+
+	plain, _, err := resumed.Receive(sendOne(t, alice, "third"))
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("third"))
+}
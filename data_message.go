@@ -55,7 +55,7 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 	dataMessage.sign(keys.sendingMACKey, header, c.version)
 
 	c.updateMayRetransmitTo(noRetransmit)
-	c.lastMessage(message)
+	c.lastSentMessage(message)
 
 	x := dataMessageExtra{keys.extraKey}
 
@@ -87,7 +87,7 @@ func (c *Conversation) createSerializedDataMessage(msg []byte, flag byte, tlvs [
 }
 
 func (c *Conversation) fragEncode(msg messageWithHeader) []ValidMessage {
-	return c.fragment(c.encode(msg), c.fragmentSize)
+	return c.fragment(c.encode(msg), c.currentFragmentSize())
 }
 
 func (c *Conversation) encode(msg messageWithHeader) encodedMessage {
@@ -131,6 +131,7 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 	if err = dataMessage.checkSign(sessionKeys.receivingMACKey, header, c.version); err != nil {
 		return
 	}
+	c.keys.acceptMessageCounter(dataMessage)
 
 	p := plainDataMsg{}
 	//this can't return an error since receivingAESKey is a AES-128 key
@@ -29,6 +29,10 @@
 //  c.Policies.SendWhitespaceTag()
 //  c.Policies.WhitespaceStartAKE()
 //
+//  // or use one of the presets, or parse them from a string
+//  c.Policies = otr3.PolicyOpportunistic
+//  c.Policies, err = otr3.ParsePolicy("allow-v3,require-encryption")
+//
 //  // You can also setup a debug mode
 //  c.SetDebug(true)
 //
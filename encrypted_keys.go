@@ -0,0 +1,163 @@
+package otr3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var encryptedKeysMagic = []byte("OTR3-ENCRYPTED-PRIVKEYS")
+
+const encryptedKeysVersion = uint16(1)
+
+var errCorruptEncryptedKeys = newOtrError("corrupt encrypted private keys")
+var errUnsupportedEncryptedKeysVersion = newOtrError("unsupported encrypted private keys version")
+
+func encryptedKeysHeader(v uint16) []byte {
+	return AppendShort(makeCopy(encryptedKeysMagic), v)
+}
+
+// ExportEncryptedKeys will write all the accounts in libotr format to w, encrypted and authenticated with a key derived from the passphrase
+func ExportEncryptedKeys(acs []*Account, w io.Writer, passphrase []byte) error {
+	plain := &wipingBuffer{}
+	defer plain.wipe()
+	if err := exportAccounts(acs, plain); err != nil {
+		return err
+	}
+
+	return writeEncryptedKeys(plain.b, w, passphrase)
+}
+
+// wipingBuffer collects sensitive data written to it. When it has to grow, the old contents are wiped
+// before they are left behind for the garbage collector.
+type wipingBuffer struct {
+	b []byte
+}
+
+func (w *wipingBuffer) Write(p []byte) (int, error) {
+	if len(w.b)+len(p) > cap(w.b) {
+		grown := make([]byte, len(w.b), 2*cap(w.b)+len(p))
+		copy(grown, w.b)
+		w.wipe()
+		w.b = grown
+	}
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+func (w *wipingBuffer) wipe() {
+	wipeBytes(w.b[:cap(w.b)])
+}
+
+// ImportEncryptedKeys will read the data written by ExportEncryptedKeys and return all accounts defined in it
+func ImportEncryptedKeys(r io.Reader, passphrase []byte) ([]*Account, error) {
+	plain, err := readEncryptedKeys(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(plain)
+
+	return ImportKeys(bytes.NewReader(plain))
+}
+
+// ExportEncryptedKeysToFile will create the named file (or truncate it) and write all the accounts to that file, encrypted with the passphrase
+func ExportEncryptedKeysToFile(acs []*Account, fname string, passphrase []byte) error {
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := ExportEncryptedKeys(acs, f, passphrase); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ImportEncryptedKeysFromFile will read the encrypted private key file given and return all accounts defined in it
+func ImportEncryptedKeysFromFile(fname string, passphrase []byte) ([]*Account, error) {
+	f, err := os.Open(filepath.Clean(fname))
+	if err != nil {
+		return nil, err
+	}
+
+	res, e := ImportEncryptedKeys(f, passphrase)
+	if e != nil {
+		_ = f.Close()
+		return nil, e
+	}
+
+	return res, f.Close()
+}
+
+// EncryptKeys reads plaintext libotr private keys from r and writes them to w, encrypted with the passphrase.
+// The keys are validated before anything is written.
+func EncryptKeys(r io.Reader, w io.Writer, passphrase []byte) error {
+	plain, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	defer wipeBytes(plain)
+
+	if _, err := ImportKeys(bytes.NewReader(plain)); err != nil {
+		return err
+	}
+
+	return writeEncryptedKeys(plain, w, passphrase)
+}
+
+// RotateKeysPassphrase reads encrypted private keys from r and writes them to w, encrypted with the new passphrase instead of the old one.
+// The plaintext keys only ever exist in memory, and are wiped before returning.
+func RotateKeysPassphrase(r io.Reader, w io.Writer, oldPassphrase, newPassphrase []byte) error {
+	plain, err := readEncryptedKeys(r, oldPassphrase)
+	if err != nil {
+		return err
+	}
+	defer wipeBytes(plain)
+
+	return writeEncryptedKeys(plain, w, newPassphrase)
+}
+
+func writeEncryptedKeys(plain []byte, w io.Writer, passphrase []byte) error {
+	header := encryptedKeysHeader(encryptedKeysVersion)
+	sealed, err := sealWithPassphrase(rand.Reader, header, passphrase, plain)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	_, _ = bw.Write(header)
+	_, _ = bw.Write(sealed)
+	return bw.Flush()
+}
+
+func readEncryptedKeys(r io.Reader, passphrase []byte) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header := encryptedKeysHeader(encryptedKeysVersion)
+	if !bytes.HasPrefix(data, encryptedKeysMagic) || len(data) < len(header) {
+		return nil, errCorruptEncryptedKeys
+	}
+
+	if !bytes.Equal(data[:len(header)], header) {
+		return nil, errUnsupportedEncryptedKeysVersion
+	}
+
+	plain, rest, err := openWithPassphrase(header, passphrase, data[len(header):])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) > 0 {
+		wipeBytes(plain)
+		return nil, errCorruptEncryptedKeys
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,130 @@
+package otr3
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func fixtureAccount() *Account {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	return &Account{Name: "hello", Protocol: "go-xmpp", Key: priv}
+}
+
+func Test_ExportEncryptedKeys_canBeImportedWithTheSamePassphrase(t *testing.T) {
+	acc := fixtureAccount()
+
+	var buf bytes.Buffer
+	assertNil(t, ExportEncryptedKeys([]*Account{acc}, &buf, []byte("secret")))
+	assertFalse(t, bytes.Contains(buf.Bytes(), []byte("private-key")))
+
+	res, err := ImportEncryptedKeys(&buf, []byte("secret"))
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertEquals(t, res[0].Name, "hello")
+	assertDeepEquals(t, res[0].Key, acc.Key)
+}
+
+func Test_ImportEncryptedKeys_failsWithTheWrongPassphrase(t *testing.T) {
+	var buf bytes.Buffer
+	assertNil(t, ExportEncryptedKeys([]*Account{fixtureAccount()}, &buf, []byte("secret")))
+
+	_, err := ImportEncryptedKeys(&buf, []byte("not secret"))
+	assertEquals(t, err, errWrongPassphrase)
+}
+
+func Test_ImportEncryptedKeys_failsForPlaintextKeys(t *testing.T) {
+	var buf bytes.Buffer
+	exportAccounts([]*Account{fixtureAccount()}, &buf)
+
+	_, err := ImportEncryptedKeys(&buf, []byte("secret"))
+	assertEquals(t, err, errCorruptEncryptedKeys)
+}
+
+func Test_ImportEncryptedKeys_failsForAnUnknownVersion(t *testing.T) {
+	data := append(encryptedKeysHeader(42), 0x01, 0x02)
+
+	_, err := ImportEncryptedKeys(bytes.NewReader(data), []byte("secret"))
+	assertEquals(t, err, errUnsupportedEncryptedKeysVersion)
+}
+
+func Test_ImportEncryptedKeys_failsForTrailingData(t *testing.T) {
+	var buf bytes.Buffer
+	assertNil(t, ExportEncryptedKeys([]*Account{fixtureAccount()}, &buf, []byte("secret")))
+	buf.WriteByte(0x00)
+
+	_, err := ImportEncryptedKeys(&buf, []byte("secret"))
+	assertEquals(t, err, errCorruptEncryptedKeys)
+}
+
+func Test_EncryptKeys_encryptsAPlaintextKeyFile(t *testing.T) {
+	var plain, encrypted bytes.Buffer
+	exportAccounts([]*Account{fixtureAccount()}, &plain)
+
+	assertNil(t, EncryptKeys(&plain, &encrypted, []byte("secret")))
+
+	res, err := ImportEncryptedKeys(&encrypted, []byte("secret"))
+	assertNil(t, err)
+	assertDeepEquals(t, res[0].Key, fixtureAccount().Key)
+}
+
+func Test_EncryptKeys_failsForInvalidKeys(t *testing.T) {
+	var encrypted bytes.Buffer
+	err := EncryptKeys(bytes.NewBufferString("(privkeys (account"), &encrypted, []byte("secret"))
+	assertNotNil(t, err)
+	assertEquals(t, encrypted.Len(), 0)
+}
+
+func Test_RotateKeysPassphrase_reencryptsWithTheNewPassphrase(t *testing.T) {
+	var before, after bytes.Buffer
+	assertNil(t, ExportEncryptedKeys([]*Account{fixtureAccount()}, &before, []byte("old")))
+
+	assertNil(t, RotateKeysPassphrase(bytes.NewReader(before.Bytes()), &after, []byte("old"), []byte("new")))
+
+	_, err := ImportEncryptedKeys(bytes.NewReader(after.Bytes()), []byte("old"))
+	assertEquals(t, err, errWrongPassphrase)
+
+	res, err := ImportEncryptedKeys(bytes.NewReader(after.Bytes()), []byte("new"))
+	assertNil(t, err)
+	assertDeepEquals(t, res[0].Key, fixtureAccount().Key)
+}
+
+func Test_RotateKeysPassphrase_writesNothingWithTheWrongPassphrase(t *testing.T) {
+	var before, after bytes.Buffer
+	assertNil(t, ExportEncryptedKeys([]*Account{fixtureAccount()}, &before, []byte("old")))
+
+	err := RotateKeysPassphrase(&before, &after, []byte("wrong"), []byte("new"))
+	assertEquals(t, err, errWrongPassphrase)
+	assertEquals(t, after.Len(), 0)
+}
+
+func Test_ExportEncryptedKeysToFile_exportsKeysToAFile(t *testing.T) {
+	acc := fixtureAccount()
+
+	err := ExportEncryptedKeysToFile([]*Account{acc}, "test_resources/test_export_of_encrypted_keys.blah", []byte("secret"))
+	defer os.Remove("test_resources/test_export_of_encrypted_keys.blah")
+	assertNil(t, err)
+
+	res, err2 := ImportEncryptedKeysFromFile("test_resources/test_export_of_encrypted_keys.blah", []byte("secret"))
+	assertNil(t, err2)
+	assertDeepEquals(t, res[0].Key, acc.Key)
+}
+
+func Test_ImportEncryptedKeysFromFile_returnsAnErrorForAMissingFile(t *testing.T) {
+	_, err := ImportEncryptedKeysFromFile("test_resources/this_file_does_not_exist.asc", []byte("secret"))
+	assertNotNil(t, err)
+}
+
+func Test_wipingBuffer_wipesWhatItLeavesBehindWhenGrowing(t *testing.T) {
+	w := &wipingBuffer{}
+	_, _ = w.Write([]byte("secret"))
+	old := w.b
+
+	_, _ = w.Write([]byte(" and more secret"))
+	assertDeepEquals(t, w.b, []byte("secret and more secret"))
+	assertDeepEquals(t, old, make([]byte, len(old)))
+
+	w.wipe()
+	assertDeepEquals(t, w.b, make([]byte, len(w.b)))
+}
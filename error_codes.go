@@ -34,6 +34,10 @@ func (d dynamicErrorMessageHandler) HandleErrorMessage(error ErrorCode) []byte {
 }
 
 func (c *Conversation) generatePotentialErrorMessage(ec ErrorCode) {
+	if c.metrics != nil {
+		c.metrics.MessageError(ec)
+	}
+
 	if c.errorMessageHandler != nil {
 		msg := c.errorMessageHandler.HandleErrorMessage(ec)
 		c.injectMessage(append(append(errorMarker, ' '), msg...))
@@ -0,0 +1,77 @@
+package otr3
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// fingerprintLength is the length in bytes of the SHA-1 fingerprints of the keys OTR uses
+	fingerprintLength      = sha1.Size
+	fingerprintGroupLength = 8
+)
+
+var errInvalidFingerprint = newOtrError("invalid fingerprint")
+
+// FormatFingerprint returns the fingerprint in the human readable format used by libotr,
+// uppercase hexadecimal in groups of eight digits separated by spaces:
+//
+//	XXXXXXXX XXXXXXXX XXXXXXXX XXXXXXXX XXXXXXXX
+func FormatFingerprint(fp []byte) string {
+	h := strings.ToUpper(hex.EncodeToString(fp))
+
+	groups := make([]string, 0, len(h)/fingerprintGroupLength+1)
+	for len(h) > fingerprintGroupLength {
+		groups = append(groups, h[:fingerprintGroupLength])
+		h = h[fingerprintGroupLength:]
+	}
+	groups = append(groups, h)
+
+	return strings.Join(groups, " ")
+}
+
+// ParseFingerprint parses a fingerprint in the format returned by FormatFingerprint. It has to be a full fingerprint
+// of 40 hexadecimal digits. The digits can be in either case, and the spaces between the groups can be left out - but if
+// spaces are used, there has to be exactly one between every group.
+func ParseFingerprint(s string) ([]byte, error) {
+	digits := s
+	if strings.Contains(s, " ") {
+		groups := strings.Split(s, " ")
+		for _, g := range groups {
+			if len(g) != fingerprintGroupLength {
+				return nil, errInvalidFingerprint
+			}
+		}
+		digits = strings.Join(groups, "")
+	}
+
+	if len(digits) != hex.EncodedLen(fingerprintLength) {
+		return nil, errInvalidFingerprint
+	}
+
+	fp, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, errInvalidFingerprint
+	}
+
+	return fp, nil
+}
+
+// FingerprintsEqual returns true if the two fingerprints are equal. The comparison runs in constant time.
+func FingerprintsEqual(fp1, fp2 []byte) bool {
+	return len(fp1) > 0 && subtle.ConstantTimeCompare(fp1, fp2) == 1
+}
+
+// HasFingerprint returns true if the given public key has the given fingerprint. The comparison runs in constant time.
+func HasFingerprint(pub PublicKey, fp []byte) bool {
+	return pub != nil && FingerprintsEqual(pub.Fingerprint(), fp)
+}
+
+// SamePublicKeys returns true if the two public keys have the same fingerprint, even when they are different values,
+// for example one parsed from a file and the other received from the peer. The comparison runs in constant time.
+// PublicKey.IsSame only considers a key the same as itself.
+func SamePublicKeys(pub1, pub2 PublicKey) bool {
+	return pub1 != nil && pub2 != nil && FingerprintsEqual(pub1.Fingerprint(), pub2.Fingerprint())
+}
@@ -0,0 +1,68 @@
+package otr3
+
+import "testing"
+
+func Test_FormatFingerprint_groupsUppercaseHexInEights(t *testing.T) {
+	fp := bytesFromHex("0102030405060708090a0b0c0d0e0f1011121314")
+	assertEquals(t, FormatFingerprint(fp), "01020304 05060708 090A0B0C 0D0E0F10 11121314")
+}
+
+func Test_ParseFingerprint_acceptsTheFormattedFingerprint(t *testing.T) {
+	res, err := ParseFingerprint("01020304 05060708 090A0B0C 0D0E0F10 11121314")
+	assertNil(t, err)
+	assertDeepEquals(t, res, bytesFromHex("0102030405060708090a0b0c0d0e0f1011121314"))
+}
+
+func Test_ParseFingerprint_acceptsLowercaseWithoutSpaces(t *testing.T) {
+	res, err := ParseFingerprint("0102030405060708090a0b0c0d0e0f1011121314")
+	assertNil(t, err)
+	assertDeepEquals(t, res, bytesFromHex("0102030405060708090a0b0c0d0e0f1011121314"))
+}
+
+func Test_ParseFingerprint_rejectsMalformedInput(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"0102030",
+		"01020304  05060708 090A0B0C 0D0E0F10 11121314",
+		"0102 030405060708090A0B0C0D0E0F1011121314",
+		"01020304 05060708 090A0B0C 0D0E0F10 11121314 ",
+		"0102030405060708090a0b0c0d0e0f10111213XY",
+		"AAAAAAAA",
+		"01020304 05060708 090A0B0C 0D0E0F10",
+		"01020304 05060708 090A0B0C 0D0E0F10 11121314 15161718",
+		"0102030405060708090a0b0c0d0e0f101112131415161718",
+	} {
+		_, err := ParseFingerprint(s)
+		assertEquals(t, err, errInvalidFingerprint)
+	}
+}
+
+func Test_FingerprintsEqual_comparesTheContent(t *testing.T) {
+	assertTrue(t, FingerprintsEqual([]byte{0x01, 0x02}, []byte{0x01, 0x02}))
+	assertFalse(t, FingerprintsEqual([]byte{0x01, 0x02}, []byte{0x01, 0x03}))
+	assertFalse(t, FingerprintsEqual([]byte{0x01, 0x02}, []byte{0x01}))
+	assertFalse(t, FingerprintsEqual(nil, nil))
+}
+
+func Test_HasFingerprint_matchesTheFingerprintOfTheKey(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+	assertTrue(t, HasFingerprint(pub, pub.Fingerprint()))
+	assertFalse(t, HasFingerprint(pub, bobPrivateKey.PublicKey().Fingerprint()))
+	assertFalse(t, HasFingerprint(nil, pub.Fingerprint()))
+}
+
+func Test_SamePublicKeys_comparesParsedKeysByContent(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+	_, ok, parsed := ParsePublicKey(pub.Serialize())
+	assertTrue(t, ok)
+	assertTrue(t, SamePublicKeys(pub, parsed))
+	assertFalse(t, SamePublicKeys(pub, bobPrivateKey.PublicKey()))
+	assertFalse(t, SamePublicKeys(pub, nil))
+}
+
+func Test_DSAPublicKey_IsSame_onlyConsidersAKeyTheSameAsItself(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+	_, _, parsed := ParsePublicKey(pub.Serialize())
+	assertTrue(t, pub.IsSame(pub))
+	assertFalse(t, pub.IsSame(parsed))
+}
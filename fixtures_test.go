@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"io"
 	"math/big"
+	"testing"
 )
 
 type fixedRandReader struct {
@@ -37,6 +38,119 @@ func fixtureConversationWithVersion(v otrVersion) *Conversation {
 	return newConversation(v, fixtureRand())
 }
 
+// fixtureEncryptedConversations returns two conversations that have finished the AKE with each other, using real randomness
+func fixtureConversationWithKey(key PrivateKey) *Conversation {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = policies(allowV2 | allowV3)
+	c.SetOurKeys([]PrivateKey{key})
+	return c
+}
+
+func fixtureConversationWithInstanceTag(key PrivateKey, tag uint32) *Conversation {
+	c := fixtureConversationWithKey(key)
+	c.InitializeInstanceTag(tag)
+	return c
+}
+
+// fixtureConversationPair returns two conversations that can talk to each other, but haven't started the AKE
+func fixtureConversationPair() (alice, bob *Conversation) {
+	return fixtureConversationWithKey(alicePrivateKey), fixtureConversationWithKey(bobPrivateKey)
+}
+
+func fixtureEncryptedConversations() (alice, bob *Conversation) {
+	alice, bob = fixtureConversationPair()
+
+	_, toSend, _ := bob.Receive(alice.QueryMessage())
+	for len(toSend) > 0 {
+		_, toSend, _ = alice.Receive(toSend[0])
+		if len(toSend) > 0 {
+			_, toSend, _ = bob.Receive(toSend[0])
+		}
+	}
+
+	return alice, bob
+}
+
+// fixtureEncryptedConversationsWithReceiveWindow returns encrypted conversations that keep the given number of key pairs in their receive windows
+func fixtureEncryptedConversationsWithReceiveWindow(size int) (alice, bob *Conversation) {
+	alice, bob = fixtureEncryptedConversations()
+	alice.SetReceiveWindow(size)
+	bob.SetReceiveWindow(size)
+	return alice, bob
+}
+
+func sendOne(t *testing.T, from *Conversation, msg string) ValidMessage {
+	toSend, err := from.Send(ValidMessage(msg))
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	return toSend[0]
+}
+
+func exchangeMessages(t *testing.T, alice, bob *Conversation, rounds int) {
+	for i := 0; i < rounds; i++ {
+		_, _, err := bob.Receive(sendOne(t, alice, "ping"))
+		assertNil(t, err)
+		_, _, err = alice.Receive(sendOne(t, bob, "pong"))
+		assertNil(t, err)
+	}
+}
+
+func Test_receive_signalsAndDiscardsAReplayedDataMessage(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	msg := sendOne(t, alice, "hello")
+
+	plain, _, err := bob.Receive(msg)
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+
+	bob.expectMessageEvent(t, func() {
+		plain, toSend, err := bob.Receive(msg)
+		assertEquals(t, err, errMessageReplayed)
+		assertNil(t, plain)
+		assertNil(t, toSend)
+	}, MessageEventReceivedMessageReplayed, nil, nil)
+}
+
+func withForgedMAC(t *testing.T, c *Conversation, msg ValidMessage) ValidMessage {
+	decoded, err := decode(encodedMessage(msg))
+	assertNil(t, err)
+	header, body, err := c.version.parseMessageHeader(c, decoded)
+	assertNil(t, err)
+
+	dm := dataMsg{}
+	assertNil(t, dm.deserialize(body, c.version))
+	dm.authenticator[0] ^= 0xFF
+	return ValidMessage(c.encode(append(makeCopy(header), dm.serialize(c.version)...)))
+}
+
+func Test_receive_acceptsTheGenuineMessageAfterAForgedCopyOfIt(t *testing.T) {
+	for _, window := range []int{0, 4} {
+		alice, bob := fixtureEncryptedConversationsWithReceiveWindow(window)
+		msg := sendOne(t, alice, "hello")
+
+		plain, _, err := bob.Receive(withForgedMAC(t, bob, msg))
+		assertEquals(t, err, newOtrConflictError("bad signature MAC in encrypted signature"))
+		assertNil(t, plain)
+
+		plain, _, err = bob.Receive(msg)
+		assertNil(t, err)
+		assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	}
+}
+
+func exchangeAll(t *testing.T, from, to *Conversation, msgs []ValidMessage) {
+	for len(msgs) > 0 {
+		var replies []ValidMessage
+		for _, m := range msgs {
+			_, ts, err := to.Receive(m)
+			assertNil(t, err)
+			replies = append(replies, ts...)
+		}
+		msgs = replies
+		from, to = to, from
+	}
+}
+
 func fixtureDHCommitMsg() []byte {
 	c := fixtureConversation()
 	c.theirInstanceTag = 0
@@ -0,0 +1,269 @@
+package otr3
+
+import (
+	"bytes"
+	"time"
+)
+
+const (
+	// How large can a reassembled message be by default?
+	defaultMaxReassembledSize = 1 << 20
+	// How many bytes can all partially reassembled messages take up together by default?
+	defaultReassemblyBudget = 4 << 20
+	// For how long is a partially reassembled message kept by default, without receiving any new fragments for it?
+	defaultReassemblyExpiry = 2 * time.Minute
+	// How many partially reassembled messages are kept at most?
+	maxPartialMessages = 16
+	// How many partially reassembled messages from the same sender instance are kept at most?
+	maxPartialMessagesPerInstance = 10
+	// How many bytes does a partially reassembled message count against the budget, besides its fragments?
+	// Without this, fragments with empty payloads could create partial messages for free.
+	partialMessageOverhead = 128
+)
+
+// fragmentKey identifies the messages a fragment can belong to. Fragments don't carry any message identifier,
+// so messages from the same instance that are fragmented into the same number of pieces are told apart by
+// which fragment they are waiting for. Version 2 fragments have no instance tags, so two interleaved version 2
+// messages with the same number of fragments can be spliced into each other - the fragment continues the oldest
+// message waiting for it. A spliced data message fails its MAC check and is reported like any unreadable message.
+type fragmentKey struct {
+	instanceTag uint32
+	total       uint16
+}
+
+type partialMessage struct {
+	key          fragmentKey
+	fctx         fragmentationContext
+	lastReceived time.Time
+}
+
+// fragmentReassembly keeps all messages that are being reassembled from fragments, in the order their first fragment arrived.
+// Unlike libotr, receiving a message that isn't fragmented doesn't forget the partial messages - they are only dropped
+// when they break the reassembly limits.
+type fragmentReassembly struct {
+	partial []*partialMessage
+	// used is what the partial messages count against the budget, and perInstance how many of them each sender instance has
+	used        int
+	perInstance map[uint32]int
+
+	maxSize int
+	budget  int
+	expiry  time.Duration
+}
+
+// SetReassemblyLimits decides how large a message reassembled from fragments can be, how many bytes all partially
+// reassembled messages can take up together, and for how long a partially reassembled message is kept when no new
+// fragments arrive for it. Partial messages that break these limits are dropped. Zero values mean the defaults
+// of 1 MiB, 4 MiB and 2 minutes. Every partial message counts 128 bytes against the budget besides its fragments,
+// and no more than 16 partial messages are kept, at most 10 of them from the same sender instance.
+func (c *Conversation) SetReassemblyLimits(maxSize, budget int, expiry time.Duration) {
+	c.fragments.maxSize = maxSize
+	c.fragments.budget = budget
+	c.fragments.expiry = expiry
+}
+
+func (r *fragmentReassembly) maxSizeOrDefault() int {
+	if r.maxSize > 0 {
+		return r.maxSize
+	}
+	return defaultMaxReassembledSize
+}
+
+func (r *fragmentReassembly) budgetOrDefault() int {
+	if r.budget > 0 {
+		return r.budget
+	}
+	return defaultReassemblyBudget
+}
+
+func (r *fragmentReassembly) expiryOrDefault() time.Duration {
+	if r.expiry > 0 {
+		return r.expiry
+	}
+	return defaultReassemblyExpiry
+}
+
+// waitingFor returns the oldest partial message that the fragment with the given index continues
+func (r *fragmentReassembly) waitingFor(key fragmentKey, ix uint16) *partialMessage {
+	for _, p := range r.partial {
+		if p.key == key && fragmentIsNextMessage(p.fctx, ix, key.total) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (r *fragmentReassembly) size() int {
+	return r.used
+}
+
+func (r *fragmentReassembly) add(p *partialMessage) {
+	if r.perInstance == nil {
+		r.perInstance = make(map[uint32]int)
+	}
+	r.partial = append(r.partial, p)
+	r.perInstance[p.key.instanceTag]++
+	r.used += partialMessageOverhead + len(p.fctx.frag)
+}
+
+func (r *fragmentReassembly) update(p *partialMessage, fctx fragmentationContext) {
+	r.used += len(fctx.frag) - len(p.fctx.frag)
+	p.fctx = fctx
+}
+
+// forget stops counting p against the limits, without removing it from the list of partial messages
+func (r *fragmentReassembly) forget(p *partialMessage) {
+	r.used -= partialMessageOverhead + len(p.fctx.frag)
+	if r.perInstance[p.key.instanceTag]--; r.perInstance[p.key.instanceTag] <= 0 {
+		delete(r.perInstance, p.key.instanceTag)
+	}
+}
+
+// oldestExcept returns the oldest partial message other than p, or nil if there is none
+func (r *fragmentReassembly) oldestExcept(p *partialMessage) *partialMessage {
+	for _, pp := range r.partial {
+		if pp != p {
+			return pp
+		}
+	}
+	return nil
+}
+
+// oldestFromSameInstanceExcept returns the oldest partial message other than p from the sender instance of p, or nil if there is none
+func (r *fragmentReassembly) oldestFromSameInstanceExcept(p *partialMessage) *partialMessage {
+	for _, pp := range r.partial {
+		if pp != p && pp.key.instanceTag == p.key.instanceTag {
+			return pp
+		}
+	}
+	return nil
+}
+
+func (r *fragmentReassembly) remove(p *partialMessage) {
+	for i, pp := range r.partial {
+		if pp == p {
+			r.forget(p)
+			copy(r.partial[i:], r.partial[i+1:])
+			r.partial[len(r.partial)-1] = nil
+			r.partial = r.partial[:len(r.partial)-1]
+			return
+		}
+	}
+}
+
+// removeExpired removes the partial messages that haven't received any fragments for too long and returns them
+func (r *fragmentReassembly) removeExpired(now time.Time) []*partialMessage {
+	expiry := r.expiryOrDefault()
+	var expired []*partialMessage
+	kept := r.partial[:0]
+	for _, p := range r.partial {
+		if now.Sub(p.lastReceived) > expiry {
+			r.forget(p)
+			expired = append(expired, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	for i := len(kept); i < len(r.partial); i++ {
+		r.partial[i] = nil
+	}
+	r.partial = kept
+	return expired
+}
+
+// fragmentIdentity finds the instance tag of the sender, the index and the number of fragments of a fragment,
+// without verifying anything else about it
+func fragmentIdentity(data []byte) (instanceTag uint32, ix, l uint16, ok bool) {
+	var body []byte
+	switch {
+	case bytes.HasPrefix(data, otrv3FragmentationPrefix):
+		if _, instanceTag, ok = ExtractInstanceTags(data); !ok {
+			return
+		}
+		body = data[23:]
+	case bytes.HasPrefix(data, otrv2FragmentationPrefix):
+		body = data[len(otrv2FragmentationPrefix):]
+	default:
+		return 0, 0, 0, false
+	}
+
+	_, ix, l, ok = parseFragment(body)
+	return
+}
+
+// reassembleFragment adds the fragment to the message it belongs to, and returns that message if this fragment completed it
+func (c *Conversation) reassembleFragment(data ValidMessage, now time.Time) ([]byte, error) {
+	c.expireFragments(now)
+
+	instanceTag, ix, l, ok := fragmentIdentity(data)
+	if !ok {
+		_, err := c.receiveFragment(fragmentationContext{}, data)
+		return nil, err
+	}
+
+	key := fragmentKey{instanceTag, l}
+	p := c.fragments.waitingFor(key, ix)
+	var before fragmentationContext
+	if p != nil {
+		before = p.fctx
+	}
+
+	after, err := c.receiveFragment(before, data)
+	if err != nil || after.currentIndex != ix || after.currentLen != l {
+		return nil, err
+	}
+
+	if p == nil {
+		p = &partialMessage{key: key}
+		c.fragments.add(p)
+	}
+	c.fragments.update(p, after)
+	p.lastReceived = now
+
+	if len(p.fctx.frag) > c.fragments.maxSizeOrDefault() {
+		c.abandonFragments(p, "message too large")
+		return nil, nil
+	}
+
+	if fragmentsFinished(p.fctx) {
+		c.fragments.remove(p)
+		if c.metrics != nil {
+			c.metrics.FragmentsReassembled(int(l))
+		}
+		return p.fctx.frag, nil
+	}
+
+	// A message that can't fit in the budget by itself is dropped, otherwise older messages make room for it
+	if partialMessageOverhead+len(p.fctx.frag) > c.fragments.budgetOrDefault() {
+		c.abandonFragments(p, "reassembly budget exceeded")
+		return nil, nil
+	}
+
+	for c.fragments.perInstance[key.instanceTag] > maxPartialMessagesPerInstance {
+		c.abandonFragments(c.fragments.oldestFromSameInstanceExcept(p), "too many partial messages from the instance")
+	}
+
+	for len(c.fragments.partial) > maxPartialMessages {
+		c.abandonFragments(c.fragments.oldestExcept(p), "too many partial messages")
+	}
+
+	for c.fragments.size() > c.fragments.budgetOrDefault() {
+		c.abandonFragments(c.fragments.oldestExcept(p), "reassembly budget exceeded")
+	}
+
+	return nil, nil
+}
+
+func (c *Conversation) abandonFragments(p *partialMessage, reason string) {
+	c.fragments.remove(p)
+	c.logWarn("partial message abandoned", "reason", reason, "fragments", p.fctx.currentIndex, "total", p.key.total)
+	c.messageEvent(MessageEventFragmentsAbandoned)
+}
+
+// expireFragments drops the partial messages that haven't received any fragments for too long
+func (c *Conversation) expireFragments(now time.Time) {
+	for _, p := range c.fragments.removeExpired(now) {
+		c.logWarn("partial message expired", "fragments", p.fctx.currentIndex, "total", p.key.total)
+		c.messageEvent(MessageEventFragmentsExpired)
+	}
+}
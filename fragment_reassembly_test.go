@@ -0,0 +1,231 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func receiveAll(t *testing.T, c *Conversation, msgs ...string) []string {
+	var result []string
+	for _, m := range msgs {
+		plain, _, err := c.Receive(ValidMessage(m))
+		assertNil(t, err)
+		if plain != nil {
+			result = append(result, string(plain))
+		}
+	}
+	return result
+}
+
+func Test_Receive_reassemblesInterleavedMessagesWithADifferentNumberOfFragments(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+
+	received := receiveAll(t, c,
+		"?OTR,00001,00002,hel,",
+		"?OTR,00001,00003,wo,",
+		"?OTR,00002,00002,lo,",
+		"?OTR,00002,00003,rl,",
+		"?OTR,00003,00003,d!,",
+	)
+
+	assertDeepEquals(t, received, []string{"hello", "world!"})
+	assertEquals(t, len(c.fragments.partial), 0)
+}
+
+func Test_Receive_reassemblesInterleavedMessagesWithTheSameNumberOfFragments(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+
+	received := receiveAll(t, c,
+		"?OTR,00001,00002,hel,",
+		"?OTR,00001,00002,wor,",
+		"?OTR,00002,00002,lo,",
+		"?OTR,00002,00002,ld,",
+	)
+
+	assertDeepEquals(t, received, []string{"hello", "world"})
+}
+
+func Test_Receive_reassemblesInterleavedFragmentedDataMessages(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	alice.SetFragmentSize(100)
+
+	first, err := alice.Send(ValidMessage("the first message, long enough to be fragmented"))
+	assertNil(t, err)
+	second, err := alice.Send(ValidMessage("the second message, also long enough to be fragmented"))
+	assertNil(t, err)
+
+	var interleaved []string
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			interleaved = append(interleaved, string(first[i]))
+		}
+		if i < len(second) {
+			interleaved = append(interleaved, string(second[i]))
+		}
+	}
+
+	assertDeepEquals(t, receiveAll(t, bob, interleaved...), []string{
+		"the first message, long enough to be fragmented",
+		"the second message, also long enough to be fragmented",
+	})
+}
+
+func Test_reassembleFragment_ignoresAFragmentNoMessageIsWaitingFor(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	now := time.Now()
+
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00003,one,"), now)
+	complete, err := c.reassembleFragment(ValidMessage("?OTR,00003,00003,three,"), now)
+
+	assertNil(t, complete)
+	assertNil(t, err)
+	assertEquals(t, len(c.fragments.partial), 1)
+	assertEquals(t, c.fragments.partial[0].fctx.currentIndex, uint16(1))
+}
+
+func Test_Tick_expiresPartialMessagesThatHaveNotReceivedFragmentsInTime(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetReassemblyLimits(0, 0, time.Minute)
+	now := time.Now()
+
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00002,hel,"), now)
+	_, _ = c.Tick(now.Add(30 * time.Second))
+	assertEquals(t, len(c.fragments.partial), 1)
+
+	c.expectMessageEvent(t, func() {
+		_, _ = c.Tick(now.Add(2 * time.Minute))
+	}, MessageEventFragmentsExpired, nil, nil)
+	assertEquals(t, len(c.fragments.partial), 0)
+}
+
+func Test_reassembleFragment_abandonsAMessageThatIsTooLarge(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetReassemblyLimits(6, 0, 0)
+	now := time.Now()
+
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00002,hel,"), now)
+	c.expectMessageEvent(t, func() {
+		complete, err := c.reassembleFragment(ValidMessage("?OTR,00002,00002,lo world,"), now)
+		assertNil(t, complete)
+		assertNil(t, err)
+	}, MessageEventFragmentsAbandoned, nil, nil)
+	assertEquals(t, len(c.fragments.partial), 0)
+}
+
+func Test_reassembleFragment_abandonsTheOldestMessagesWhenTheBudgetIsExceeded(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetReassemblyLimits(0, 2*partialMessageOverhead+8, 0)
+	now := time.Now()
+
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00002,12345,"), now)
+	c.expectMessageEvent(t, func() {
+		_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00003,67890,"), now)
+	}, MessageEventFragmentsAbandoned, nil, nil)
+
+	assertEquals(t, len(c.fragments.partial), 1)
+	assertEquals(t, c.fragments.partial[0].key, fragmentKey{0, 3})
+}
+
+func Test_reassembleFragment_keepsTheMessageThatReceivedTheFragmentWhenTheBudgetIsExceeded(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetReassemblyLimits(0, 2*partialMessageOverhead+8, 0)
+	now := time.Now()
+
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00003,1234,"), now)
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00002,567,"), now)
+	c.expectMessageEvent(t, func() {
+		_, _ = c.reassembleFragment(ValidMessage("?OTR,00002,00003,89,"), now)
+	}, MessageEventFragmentsAbandoned, nil, nil)
+
+	assertEquals(t, len(c.fragments.partial), 1)
+	assertEquals(t, c.fragments.partial[0].key, fragmentKey{0, 3})
+	assertDeepEquals(t, c.fragments.partial[0].fctx.frag, []byte("123489"))
+}
+
+func Test_reassembleFragment_dropsAMessageThatDoesntFitInTheBudgetByItself(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetReassemblyLimits(0, partialMessageOverhead+8, 0)
+	now := time.Now()
+
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00002,12345,"), now)
+	c.expectMessageEvent(t, func() {
+		_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00003,678901234,"), now)
+	}, MessageEventFragmentsAbandoned, nil, nil)
+
+	assertEquals(t, len(c.fragments.partial), 1)
+	assertEquals(t, c.fragments.partial[0].key, fragmentKey{0, 2})
+}
+
+func Test_reassembleFragment_keepsAFloodOfEmptyFragmentsWithinTheLimits(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetReassemblyLimits(0, 0, 0)
+	now := time.Now()
+
+	for i := 0; i < 1000; i++ {
+		_, _ = c.reassembleFragment(ValidMessage(fmt.Sprintf("?OTR,00001,%05d,,", i+2)), now)
+	}
+
+	assertEquals(t, len(c.fragments.partial), maxPartialMessagesPerInstance)
+	assertEquals(t, c.fragments.size(), maxPartialMessagesPerInstance*partialMessageOverhead)
+	assertEquals(t, c.fragments.partial[0].key, fragmentKey{0, 1001 - maxPartialMessagesPerInstance + 1})
+}
+
+func Test_reassembleFragment_chargesEveryPartialMessageAgainstTheBudget(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetReassemblyLimits(0, 3*partialMessageOverhead, 0)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		_, _ = c.reassembleFragment(ValidMessage(fmt.Sprintf("?OTR,00001,%05d,,", i+2)), now)
+	}
+
+	assertEquals(t, len(c.fragments.partial), 3)
+	assertEquals(t, c.fragments.size(), 3*partialMessageOverhead)
+}
+
+func Test_reassembleFragment_limitsThePartialMessagesFromAllInstances(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourInstanceTag = 0x200
+	now := time.Now()
+
+	for i := 0; i < 3*maxPartialMessages; i++ {
+		c.theirInstanceTag = 0
+		_, _ = c.reassembleFragment(ValidMessage(fmt.Sprintf("?OTR|%08x|00000200,00001,00002,,", 0x300+i)), now)
+	}
+
+	assertEquals(t, len(c.fragments.partial), maxPartialMessages)
+	assertEquals(t, len(c.fragments.perInstance), maxPartialMessages)
+	assertEquals(t, c.fragments.size(), maxPartialMessages*partialMessageOverhead)
+}
+
+func Test_Tick_forgetsTheExpiredPartialMessagesInTheLimits(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	now := time.Now()
+
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00002,hel,"), now)
+	_, _ = c.reassembleFragment(ValidMessage("?OTR,00001,00003,wo,"), now.Add(time.Minute))
+	_, _ = c.Tick(now.Add(150 * time.Second))
+
+	assertEquals(t, len(c.fragments.partial), 1)
+	assertEquals(t, c.fragments.size(), partialMessageOverhead+2)
+	assertEquals(t, c.fragments.perInstance[0], 1)
+}
+
+func Test_fragmentIdentity_findsTheSenderInstanceTagAndPosition(t *testing.T) {
+	tag, ix, l, ok := fragmentIdentity([]byte("?OTR|00000104|00000203,00002,00004,two,"))
+	assertTrue(t, ok)
+	assertEquals(t, tag, uint32(0x104))
+	assertEquals(t, ix, uint16(2))
+	assertEquals(t, l, uint16(4))
+
+	tag, ix, l, ok = fragmentIdentity([]byte("?OTR,00001,00003,one,"))
+	assertTrue(t, ok)
+	assertEquals(t, tag, uint32(0))
+	assertEquals(t, ix, uint16(1))
+	assertEquals(t, l, uint16(3))
+
+	_, _, _, ok = fragmentIdentity([]byte("?OTR|0000"))
+	assertFalse(t, ok)
+}
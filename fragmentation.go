@@ -1,6 +1,9 @@
 package otr3
 
-import "bytes"
+import (
+	"bytes"
+	"math"
+)
 
 var (
 	fragmentSeparator      = []byte{','}
@@ -14,23 +17,23 @@ type fragmentationContext struct {
 	currentIndex, currentLen uint16
 }
 
-func min(l, r uint16) uint16 {
+func min(l, r int) int {
 	if l < r {
 		return l
 	}
 	return r
 }
 
-func fragmentStart(i, fraglen uint16) uint16 {
-	return uint16(i * fraglen)
+func fragmentStart(i, fraglen int) int {
+	return i * fraglen
 }
 
-func fragmentEnd(i, fraglen, l uint16) uint16 {
-	return uint16(min((i+1)*fraglen, l))
+func fragmentEnd(i, fraglen, l int) int {
+	return min((i+1)*fraglen, l)
 }
 
-func fragmentData(data []byte, i int, fraglen, l uint16) []byte {
-	return data[fragmentStart(uint16(i), fraglen):fragmentEnd(uint16(i), fraglen, l)]
+func fragmentData(data []byte, i, fraglen, l int) []byte {
+	return data[fragmentStart(i, fraglen):fragmentEnd(i, fraglen, l)]
 }
 
 // SetFragmentSize sets the maximum size for a message fragment.
@@ -47,18 +50,32 @@ func (c *Conversation) fragment(data encodedMessage, fraglen uint16) []ValidMess
 		return []ValidMessage{ValidMessage(data)}
 	}
 
+	// The prefix has the same length for every fragment, since the numbers in it are zero padded.
+	// One more byte is needed for the separator ending the fragment
 	fakeHeader := c.version.fragmentPrefix(1, 1, c.ourInstanceTag, c.theirInstanceTag)
-	realFraglen := (fraglen - uint16(len(fakeHeader))) - 1
+	overhead := len(fakeHeader) + 1
+
+	if int(fraglen) <= overhead {
+		c.logWarn("fragment size too small for the fragment prefix", "fragment_size", fraglen, "overhead", overhead)
+		return []ValidMessage{ValidMessage(data)}
+	}
+	realFraglen := int(fraglen) - overhead
 
-	if realFraglen <= 0 {
+	// The number of fragments has to fit in the five digits of the prefix
+	numFragments := (l + realFraglen - 1) / realFraglen
+	if numFragments > math.MaxUint16 {
+		c.logWarn("fragment size too small for the size of the message", "fragment_size", fraglen, "fragments", numFragments)
 		return []ValidMessage{ValidMessage(data)}
 	}
 
-	numFragments := (l / int(realFraglen)) + 1
+	c.logDebug("message fragmented", "fragments", numFragments, "fragment_size", fraglen)
+	if c.metrics != nil {
+		c.metrics.FragmentsSent(numFragments)
+	}
 	ret := make([]ValidMessage, numFragments)
 	for i := 0; i < numFragments; i++ {
 		prefix := c.version.fragmentPrefix(i, numFragments, c.ourInstanceTag, c.theirInstanceTag)
-		ret[i] = append(append(prefix, fragmentData(data, i, realFraglen, uint16(l))...), fragmentSeparator[0])
+		ret[i] = append(append(prefix, fragmentData(data, i, realFraglen, l)...), fragmentSeparator[0])
 	}
 	return ret
 }
@@ -121,8 +138,11 @@ func (c *Conversation) receiveFragment(beforeCtx fragmentationContext, data Vali
 		return beforeCtx, newOtrError("invalid OTR fragment")
 	}
 
+	c.logDebug("fragment received", "index", ix, "total", l)
+
 	switch {
 	case fragmentIsInvalid(ix, l):
+		c.logWarn("fragment discarded", "index", ix, "total", l)
 		return beforeCtx.discardFragment(), nil
 	case fragmentIsFirstMessage(ix, l):
 		return restartFragment(resultData, ix, l), nil
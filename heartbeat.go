@@ -5,14 +5,68 @@ import "time"
 // How long after sending a packet should we wait to send a heartbeat?
 const heartbeatInterval = 60 * time.Second
 
+// HeartbeatPolicy decides when heartbeats are sent to the peer. Heartbeats are empty data messages
+// that make sure keys get rotated even when only one side of the conversation is sending messages.
+type HeartbeatPolicy int
+
+const (
+	// HeartbeatOnInterval sends a heartbeat when nothing has been sent to the peer for the heartbeat interval.
+	// This is the default
+	HeartbeatOnInterval HeartbeatPolicy = iota
+	// HeartbeatDisabled never sends heartbeats
+	HeartbeatDisabled
+	// HeartbeatAlways sends a heartbeat in response to every message received, and on every tick
+	HeartbeatAlways
+)
+
+// String returns the string representation of the HeartbeatPolicy
+func (p HeartbeatPolicy) String() string {
+	switch p {
+	case HeartbeatOnInterval:
+		return "HeartbeatOnInterval"
+	case HeartbeatDisabled:
+		return "HeartbeatDisabled"
+	case HeartbeatAlways:
+		return "HeartbeatAlways"
+	default:
+		return "HEARTBEAT POLICY: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
 type heartbeatContext struct {
 	lastSent time.Time
+	policy   HeartbeatPolicy
+	interval time.Duration
+}
+
+// SetHeartbeatPolicy changes when heartbeats are sent for this conversation. The interval is only used
+// with HeartbeatOnInterval - if it is zero, the default interval of 60 seconds will be used.
+func (c *Conversation) SetHeartbeatPolicy(policy HeartbeatPolicy, interval time.Duration) {
+	c.heartbeat.policy = policy
+	c.heartbeat.interval = interval
+}
+
+func (c *Conversation) heartbeatInterval() time.Duration {
+	if c.heartbeat.interval > 0 {
+		return c.heartbeat.interval
+	}
+	return heartbeatInterval
 }
 
 func (c *Conversation) updateLastSent() {
 	c.heartbeat.lastSent = time.Now()
 }
 
+func (c *Conversation) heartbeatIsDue(now time.Time) bool {
+	switch c.heartbeat.policy {
+	case HeartbeatDisabled:
+		return false
+	case HeartbeatAlways:
+		return true
+	}
+	return c.heartbeat.lastSent.Before(now.Add(-c.heartbeatInterval()))
+}
+
 func (c *Conversation) maybeHeartbeat(plain MessagePlaintext, toSend messageWithHeader, err error) (MessagePlaintext, []messageWithHeader, error) {
 	if err != nil {
 		return nil, nil, err
@@ -26,11 +80,14 @@ func (c *Conversation) potentialHeartbeat(plain MessagePlaintext) (toSend messag
 		return
 	}
 
-	now := time.Now()
-	if !c.heartbeat.lastSent.Before(now.Add(-heartbeatInterval)) {
+	if !c.heartbeatIsDue(time.Now()) {
 		return
 	}
 
+	return c.heartbeatMessage()
+}
+
+func (c *Conversation) heartbeatMessage() (toSend messageWithHeader, err error) {
 	dataMsg, _, err := c.genDataMsgWithFlag(nil, messageFlagIgnoreUnreadable)
 	if err != nil {
 		return nil, err
@@ -45,3 +102,24 @@ func (c *Conversation) potentialHeartbeat(plain MessagePlaintext) (toSend messag
 	c.messageEvent(MessageEventLogHeartbeatSent)
 	return
 }
+
+// Tick should be called regularly by the application, with the current time. It returns a heartbeat
+// to send to the peer if one is due according to the heartbeat policy. This makes sure keys get rotated
+// in conversations where nothing is being sent. Queued messages and partially received fragmented
+// messages that have expired are dropped.
+func (c *Conversation) Tick(now time.Time) ([]ValidMessage, error) {
+	c.expireQueuedMessages(now)
+	c.expireFragments(now)
+
+	if c.msgState != encrypted || !c.heartbeatIsDue(now) {
+		return c.withInjections(nil, nil)
+	}
+
+	toSend, err := c.heartbeatMessage()
+	if err != nil {
+		return c.withInjections(nil, err)
+	}
+
+	c.heartbeat.lastSent = now
+	return c.withInjections(c.fragEncode(toSend), nil)
+}
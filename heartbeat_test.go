@@ -81,3 +81,87 @@ func Test_potentialHeartbeat_returnsAnErrorIfWeCantPutTogetherAMessage(t *testin
 	_, err := c.potentialHeartbeat(plain)
 	assertDeepEquals(t, err, newOtrConflictError("invalid key id for local peer"))
 }
+
+func Test_potentialHeartbeat_returnsNothingIfHeartbeatsAreDisabled(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetHeartbeatPolicy(HeartbeatDisabled, 0)
+	c.heartbeat.lastSent = time.Now().Add(-61 * time.Second)
+
+	ret, err := c.potentialHeartbeat([]byte("Foo plain"))
+	assertNil(t, ret)
+	assertNil(t, err)
+}
+
+func Test_potentialHeartbeat_alwaysSendsAHeartbeatIfConfiguredTo(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetHeartbeatPolicy(HeartbeatAlways, 0)
+	c.heartbeat.lastSent = time.Now()
+
+	ret, err := c.potentialHeartbeat([]byte("Foo plain"))
+	assertNotNil(t, ret)
+	assertNil(t, err)
+}
+
+func Test_potentialHeartbeat_usesTheConfiguredInterval(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetHeartbeatPolicy(HeartbeatOnInterval, 5*time.Second)
+	c.heartbeat.lastSent = time.Now().Add(-10 * time.Second)
+
+	ret, err := c.potentialHeartbeat([]byte("Foo plain"))
+	assertNotNil(t, ret)
+	assertNil(t, err)
+}
+
+func Test_Tick_returnsNothingIfNotEncrypted(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = plainText
+
+	ret, err := c.Tick(time.Now())
+	assertNil(t, ret)
+	assertNil(t, err)
+}
+
+func Test_Tick_returnsNothingIfAHeartbeatIsNotDue(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	now := time.Now()
+	c.heartbeat.lastSent = now.Add(-10 * time.Second)
+
+	ret, err := c.Tick(now)
+	assertNil(t, ret)
+	assertNil(t, err)
+}
+
+func Test_Tick_returnsAHeartbeatWhenDue(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	now := time.Now().Add(time.Hour)
+	c.heartbeat.lastSent = now.Add(-61 * time.Second)
+
+	c.expectMessageEvent(t, func() {
+		ret, err := c.Tick(now)
+		assertNil(t, err)
+		assertEquals(t, len(ret), 1)
+	}, MessageEventLogHeartbeatSent, nil, nil)
+	assertEquals(t, c.heartbeat.lastSent, now)
+}
+
+func Test_Tick_returnsNothingIfHeartbeatsAreDisabled(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetHeartbeatPolicy(HeartbeatDisabled, 0)
+
+	ret, err := c.Tick(time.Now())
+	assertNil(t, ret)
+	assertNil(t, err)
+}
+
+func Test_HeartbeatPolicy_String(t *testing.T) {
+	assertEquals(t, HeartbeatOnInterval.String(), "HeartbeatOnInterval")
+	assertEquals(t, HeartbeatDisabled.String(), "HeartbeatDisabled")
+	assertEquals(t, HeartbeatAlways.String(), "HeartbeatAlways")
+	assertEquals(t, HeartbeatPolicy(42).String(), "HEARTBEAT POLICY: (THIS SHOULD NEVER HAPPEN)")
+}
@@ -12,6 +12,9 @@ func (c *Conversation) injectMessage(vm ValidMessage) {
 }
 
 func (c *Conversation) withInjects(vms []ValidMessage) []ValidMessage {
+	c.abortCancelledSMPSession()
+	c.sendPendingSMPAbort()
+
 	msgs := c.injections.messages
 	c.injections.messages = c.injections.messages[0:0]
 	return append(vms, msgs...)
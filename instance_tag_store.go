@@ -0,0 +1,171 @@
+package otr3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const instanceTagsFileWarning = "# WARNING! You shouldn't copy this file to another computer. It is unnecessary and can cause problems."
+
+// InstanceTagStore keeps track of the instance tags used for our accounts, so that they stay the same between sessions
+type InstanceTagStore interface {
+	// InstanceTag returns the instance tag stored for the account and protocol, and whether one was found
+	InstanceTag(account, protocol string) (uint32, bool)
+	// SetInstanceTag records the instance tag used for the account and protocol
+	SetInstanceTag(account, protocol string, tag uint32) error
+}
+
+// InstanceTagEntry is an instance tag for an account, as stored in the libotr instance tags file
+type InstanceTagEntry struct {
+	Account  string
+	Protocol string
+	Tag      uint32
+}
+
+// ImportInstanceTags will read the libotr formatted instance tags given and return all entries defined in it
+func ImportInstanceTags(r io.Reader) ([]*InstanceTagEntry, error) {
+	var result []*InstanceTagEntry
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r\n")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Split(line, "\t")
+		if len(parts) != 3 {
+			return nil, newOtrError("couldn't import instance tags - invalid line")
+		}
+
+		tag, err := strconv.ParseUint(parts[2], 16, 32)
+		if err != nil || uint32(tag) < minValidInstanceTag {
+			return nil, newOtrError("couldn't import instance tags - invalid instance tag")
+		}
+
+		result = append(result, &InstanceTagEntry{Account: parts[0], Protocol: parts[1], Tag: uint32(tag)})
+	}
+
+	return result, s.Err()
+}
+
+// ExportInstanceTags will write all the given entries in the libotr instance tags format
+func ExportInstanceTags(entries []*InstanceTagEntry, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString(instanceTagsFileWarning + "\n")
+	for _, e := range entries {
+		_, _ = bw.WriteString(fmt.Sprintf("%s\t%s\t%08x\n", e.Account, e.Protocol, e.Tag))
+	}
+	return bw.Flush()
+}
+
+// ImportInstanceTagsFromFile will read the libotr formatted instance tags file given and return all entries defined in it
+func ImportInstanceTagsFromFile(fname string) ([]*InstanceTagEntry, error) {
+	f, err := os.Open(filepath.Clean(fname))
+	if err != nil {
+		return nil, err
+	}
+
+	res, e := ImportInstanceTags(f)
+	if e != nil {
+		_ = f.Close()
+		return nil, e
+	}
+
+	return res, f.Close()
+}
+
+// ExportInstanceTagsToFile will create the named file (or truncate it) and write all the entries to that file in libotr format.
+func ExportInstanceTagsToFile(entries []*InstanceTagEntry, fname string) error {
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := ExportInstanceTags(entries, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// FileInstanceTagStore is an InstanceTagStore backed by a file in the libotr instance tags format.
+// Every new instance tag is written to the file immediately.
+type FileInstanceTagStore struct {
+	fname   string
+	entries []*InstanceTagEntry
+}
+
+// NewFileInstanceTagStore creates an InstanceTagStore that reads and writes the given file. It is not an error for the file to not exist yet.
+func NewFileInstanceTagStore(fname string) (*FileInstanceTagStore, error) {
+	entries, err := ImportInstanceTagsFromFile(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &FileInstanceTagStore{fname: fname, entries: entries}, nil
+}
+
+// Entries returns all instance tags known to this store
+func (s *FileInstanceTagStore) Entries() []*InstanceTagEntry {
+	return s.entries
+}
+
+// InstanceTag returns the instance tag stored for the account and protocol, and whether one was found
+func (s *FileInstanceTagStore) InstanceTag(account, protocol string) (uint32, bool) {
+	for _, e := range s.entries {
+		if e.Account == account && e.Protocol == protocol {
+			return e.Tag, true
+		}
+	}
+	return 0, false
+}
+
+// SetInstanceTag records the instance tag for the account and protocol and writes the file
+func (s *FileInstanceTagStore) SetInstanceTag(account, protocol string, tag uint32) error {
+	found := false
+	for _, e := range s.entries {
+		if e.Account == account && e.Protocol == protocol {
+			e.Tag = tag
+			found = true
+		}
+	}
+
+	if !found {
+		s.entries = append(s.entries, &InstanceTagEntry{Account: account, Protocol: protocol, Tag: tag})
+	}
+
+	return ExportInstanceTagsToFile(s.entries, s.fname)
+}
+
+type instanceTagContext struct {
+	store             InstanceTagStore
+	account, protocol string
+}
+
+// SetInstanceTagStore assigns the store consulted before a new instance tag is generated for this conversation.
+// The account and protocol identify our account in the store. A newly generated instance tag will be recorded in the store.
+func (c *Conversation) SetInstanceTagStore(store InstanceTagStore, account, protocol string) {
+	c.instanceTags = instanceTagContext{store, account, protocol}
+}
+
+func (c *Conversation) storedInstanceTag() (uint32, bool) {
+	if c.instanceTags.store == nil {
+		return 0, false
+	}
+
+	tag, ok := c.instanceTags.store.InstanceTag(c.instanceTags.account, c.instanceTags.protocol)
+	return tag, ok && tag >= minValidInstanceTag
+}
+
+func (c *Conversation) storeInstanceTag(tag uint32) error {
+	if c.instanceTags.store == nil {
+		return nil
+	}
+
+	return c.instanceTags.store.SetInstanceTag(c.instanceTags.account, c.instanceTags.protocol, tag)
+}
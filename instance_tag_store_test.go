@@ -0,0 +1,99 @@
+package otr3
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+const fixtureInstanceTags = instanceTagsFileWarning + "\n" +
+	"alice@example.org\tprpl-jabber\t1a2b3c4d\n" +
+	"alice@example.org\tprpl-irc\t00000100\n"
+
+type memoryInstanceTagStore map[string]uint32
+
+func (s memoryInstanceTagStore) InstanceTag(account, protocol string) (uint32, bool) {
+	tag, ok := s[account+"/"+protocol]
+	return tag, ok
+}
+
+func (s memoryInstanceTagStore) SetInstanceTag(account, protocol string, tag uint32) error {
+	s[account+"/"+protocol] = tag
+	return nil
+}
+
+func Test_ImportInstanceTags_readsTheLibotrFormat(t *testing.T) {
+	res, err := ImportInstanceTags(bytes.NewBufferString(fixtureInstanceTags))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 2)
+	assertDeepEquals(t, *res[0], InstanceTagEntry{Account: "alice@example.org", Protocol: "prpl-jabber", Tag: 0x1a2b3c4d})
+	assertDeepEquals(t, *res[1], InstanceTagEntry{Account: "alice@example.org", Protocol: "prpl-irc", Tag: 0x100})
+}
+
+func Test_ImportInstanceTags_failsForAnInvalidLine(t *testing.T) {
+	_, err := ImportInstanceTags(bytes.NewBufferString("alice@example.org\tprpl-jabber\n"))
+	assertEquals(t, err, newOtrError("couldn't import instance tags - invalid line"))
+}
+
+func Test_ImportInstanceTags_failsForAnInvalidInstanceTag(t *testing.T) {
+	_, err := ImportInstanceTags(bytes.NewBufferString("alice@example.org\tprpl-jabber\t000000ff\n"))
+	assertEquals(t, err, newOtrError("couldn't import instance tags - invalid instance tag"))
+
+	_, err = ImportInstanceTags(bytes.NewBufferString("alice@example.org\tprpl-jabber\txyz\n"))
+	assertEquals(t, err, newOtrError("couldn't import instance tags - invalid instance tag"))
+}
+
+func Test_ExportInstanceTags_writesTheLibotrFormat(t *testing.T) {
+	entries, _ := ImportInstanceTags(bytes.NewBufferString(fixtureInstanceTags))
+
+	var buf bytes.Buffer
+	assertNil(t, ExportInstanceTags(entries, &buf))
+	assertEquals(t, buf.String(), fixtureInstanceTags)
+}
+
+func Test_FileInstanceTagStore_writesNewInstanceTagsToTheFile(t *testing.T) {
+	fname := "test_resources/test_instance_tags.blah"
+	defer os.Remove(fname)
+
+	s, err := NewFileInstanceTagStore(fname)
+	assertNil(t, err)
+	_, ok := s.InstanceTag("alice@example.org", "prpl-jabber")
+	assertFalse(t, ok)
+
+	assertNil(t, s.SetInstanceTag("alice@example.org", "prpl-jabber", 0x1234))
+
+	s2, err := NewFileInstanceTagStore(fname)
+	assertNil(t, err)
+	tag, ok := s2.InstanceTag("alice@example.org", "prpl-jabber")
+	assertTrue(t, ok)
+	assertEquals(t, tag, uint32(0x1234))
+}
+
+func Test_generateInstanceTag_usesTheInstanceTagFromTheStore(t *testing.T) {
+	store := memoryInstanceTagStore{"alice@example.org/prpl-jabber": 0x1a2b3c4d}
+	c := &Conversation{}
+	c.SetInstanceTagStore(store, "alice@example.org", "prpl-jabber")
+
+	assertEquals(t, c.GetOurInstanceTag(), uint32(0x1a2b3c4d))
+}
+
+func Test_generateInstanceTag_recordsANewInstanceTagInTheStore(t *testing.T) {
+	store := memoryInstanceTagStore{}
+	c := &Conversation{Rand: fixtureRand()}
+	c.SetInstanceTagStore(store, "alice@example.org", "prpl-jabber")
+
+	tag := c.GetOurInstanceTag()
+	assertTrue(t, tag >= minValidInstanceTag)
+	assertEquals(t, store["alice@example.org/prpl-jabber"], tag)
+}
+
+func Test_generateInstanceTag_ignoresInvalidInstanceTagsInTheStore(t *testing.T) {
+	store := memoryInstanceTagStore{"alice@example.org/prpl-jabber": 0x10}
+	c := &Conversation{Rand: fixtureRand()}
+	c.SetInstanceTagStore(store, "alice@example.org", "prpl-jabber")
+
+	tag := c.GetOurInstanceTag()
+	assertTrue(t, tag >= minValidInstanceTag)
+	assertEquals(t, store["alice@example.org/prpl-jabber"], tag)
+}
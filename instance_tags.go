@@ -21,6 +21,11 @@ func (c *Conversation) generateInstanceTag() error {
 		return nil
 	}
 
+	if tag, ok := c.storedInstanceTag(); ok {
+		c.ourInstanceTag = tag
+		return nil
+	}
+
 	var ret uint32
 	var dst [4]byte
 
@@ -34,7 +39,7 @@ func (c *Conversation) generateInstanceTag() error {
 
 	c.ourInstanceTag = ret
 
-	return nil
+	return c.storeInstanceTag(ret)
 }
 
 // ExtractInstanceTags returns our and theirs instance tags from the message, and ok if the message was parsed properly
@@ -49,8 +54,8 @@ func ExtractInstanceTags(m []byte) (ours, theirs uint32, ok bool) {
 			return 0, 0, false
 		}
 
-		_, senderInstanceTag, _ := ExtractWord(msg[messageHeaderPrefix:])
-		_, receiverInstanceTag, _ := ExtractWord(msg)
+		rest, senderInstanceTag, _ := ExtractWord(msg[messageHeaderPrefix:])
+		_, receiverInstanceTag, _ := ExtractWord(rest)
 
 		return receiverInstanceTag, senderInstanceTag, true
 	} else if bytes.HasPrefix(m, []byte("?OTR|")) {
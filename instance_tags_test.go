@@ -0,0 +1,29 @@
+package otr3
+
+import "testing"
+
+func Test_ExtractInstanceTags_returnsTheInstanceTagsOfAnEncodedMessage(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.ourInstanceTag = 0x1234
+	c.theirInstanceTag = 0x5678
+	msg, _ := c.wrapMessageHeader(msgTypeDHKey, nil)
+
+	ours, theirs, ok := ExtractInstanceTags(c.encode(msg))
+
+	assertTrue(t, ok)
+	assertEquals(t, ours, uint32(0x5678))
+	assertEquals(t, theirs, uint32(0x1234))
+}
+
+func Test_ExtractInstanceTags_returnsTheInstanceTagsOfAFragment(t *testing.T) {
+	ours, theirs, ok := ExtractInstanceTags([]byte("?OTR|00001234|00005678,00001,00002,hello,"))
+
+	assertTrue(t, ok)
+	assertEquals(t, ours, uint32(0x5678))
+	assertEquals(t, theirs, uint32(0x1234))
+}
+
+func Test_ExtractInstanceTags_isNotOkForMessagesWithoutInstanceTags(t *testing.T) {
+	_, _, ok := ExtractInstanceTags([]byte("?OTRv3?"))
+	assertFalse(t, ok)
+}
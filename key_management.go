@@ -120,6 +120,9 @@ type keyManagementContext struct {
 	counterHistory counterHistory
 	macKeyHistory  macKeyHistory
 	oldMACKeys     []macKey
+
+	receiveWindow receiveWindow
+	replays       replayCache
 }
 
 func (k *keyManagementContext) setTheirCurrentDHPubKey(key *big.Int) {
@@ -131,18 +134,34 @@ func (k *keyManagementContext) setOurCurrentDHKeys(priv secretKeyValue, pub *big
 	k.ourCurrentDHKeys.pub = setBigInt(k.ourCurrentDHKeys.pub, pub)
 }
 
+// checkMessageCounter returns an error if the counter of the message has been seen before or is too old.
+// It doesn't change anything, since the message hasn't been authenticated yet - acceptMessageCounter does that.
 func (k *keyManagementContext) checkMessageCounter(message dataMsg) error {
 	counter := k.counterHistory.findCounterFor(message.recipientKeyID, message.senderKeyID)
 	theirNextCounter := binary.BigEndian.Uint64(message.topHalfCtr[:])
 
-	if theirNextCounter <= counter.theirCounter {
+	if k.replays.contains(message.recipientKeyID, message.senderKeyID, theirNextCounter) {
+		return errMessageReplayed
+	}
+
+	if theirNextCounter <= counter.theirCounter && !k.acceptsLateCounter(message.recipientKeyID, message.senderKeyID, theirNextCounter) {
 		return newOtrConflictError("counter regressed")
 	}
 
-	counter.theirCounter = theirNextCounter
 	return nil
 }
 
+// acceptMessageCounter records the counter of an authenticated message, so that the message can't be replayed
+func (k *keyManagementContext) acceptMessageCounter(message dataMsg) {
+	counter := k.counterHistory.findCounterFor(message.recipientKeyID, message.senderKeyID)
+	theirNextCounter := binary.BigEndian.Uint64(message.topHalfCtr[:])
+
+	k.replays.add(message.recipientKeyID, message.senderKeyID, theirNextCounter)
+	if theirNextCounter > counter.theirCounter {
+		counter.theirCounter = theirNextCounter
+	}
+}
+
 func (k *keyManagementContext) revealMACKeys() []macKey {
 	ret := k.oldMACKeys
 	k.oldMACKeys = []macKey{}
@@ -170,14 +189,21 @@ func (k *keyManagementContext) generateNewDHKeyPair(randomness io.Reader) error
 
 func (k *keyManagementContext) revealMACKeysForOurPreviousKeyID() {
 	keys := k.macKeyHistory.forgetMACKeysForOurKey(k.ourKeyID - 1)
-	k.oldMACKeys = append(k.oldMACKeys, keys...)
+	k.oldMACKeys = append(k.oldMACKeys, k.receiveWindow.holdBack(keys)...)
 }
 
 func (c *Conversation) rotateKeys(dataMessage dataMsg) error {
+	ourKeyID, theirKeyID := c.keys.ourKeyID, c.keys.theirKeyID
+
 	if err := c.keys.rotateOurKeys(dataMessage.recipientKeyID, c.rand()); err != nil {
 		return err
 	}
 	c.keys.rotateTheirKey(dataMessage.senderKeyID, dataMessage.y)
+	c.keys.forgetUnusableKeyPairs()
+
+	if ourKeyID != c.keys.ourKeyID || theirKeyID != c.keys.theirKeyID {
+		c.logDebug("keys rotated", "our_key_id", c.keys.ourKeyID, "their_key_id", c.keys.theirKeyID)
+	}
 
 	return nil
 }
@@ -192,7 +218,7 @@ func (k *keyManagementContext) rotateOurKeys(recipientKeyID uint32, randomness i
 
 func (k *keyManagementContext) revealMACKeysForTheirPreviousKeyID() {
 	keys := k.macKeyHistory.forgetMACKeysForTheirKey(k.theirKeyID - 1)
-	k.oldMACKeys = append(k.oldMACKeys, keys...)
+	k.oldMACKeys = append(k.oldMACKeys, k.receiveWindow.holdBack(keys)...)
 }
 
 func (k *keyManagementContext) rotateTheirKey(senderKeyID uint32, pubDHKey *big.Int) {
@@ -210,16 +236,17 @@ func (k *keyManagementContext) calculateDHSessionKeys(ourKeyID, theirKeyID uint3
 
 	ourPrivKey, ourPubKey, err := k.pickOurKeys(ourKeyID)
 	if err != nil {
-		return ret, err
+		return k.receiveWindow.lookupOr(ourKeyID, theirKeyID, err)
 	}
 
 	theirPubKey, err := k.pickTheirKey(theirKeyID)
 	if err != nil {
-		return ret, err
+		return k.receiveWindow.lookupOr(ourKeyID, theirKeyID, err)
 	}
 
 	ret = calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey, v)
 	k.macKeyHistory.addKeys(ourKeyID, theirKeyID, ret.receivingMACKey)
+	k.oldMACKeys = append(k.oldMACKeys, k.receiveWindow.remember(ourKeyID, theirKeyID, ret)...)
 
 	return ret, nil
 }
@@ -305,6 +305,8 @@ func Test_checkMessageCounter_messageIsValidWhenCounterIsLargerThanTheLastReceiv
 	msg.topHalfCtr[7] = 3
 	err := c.checkMessageCounter(msg)
 	assertEquals(t, err, nil)
+	assertEquals(t, ctr.theirCounter, uint64(2))
+	c.acceptMessageCounter(msg)
 	assertEquals(t, ctr.theirCounter, uint64(3))
 
 	ctr = c.counterHistory.findCounterFor(2, 1)
@@ -317,6 +319,7 @@ func Test_checkMessageCounter_messageIsValidWhenCounterIsLargerThanTheLastReceiv
 	msg.topHalfCtr[7] = 1
 	err = c.checkMessageCounter(msg)
 	assertEquals(t, err, nil)
+	c.acceptMessageCounter(msg)
 	assertEquals(t, ctr.theirCounter, uint64(1))
 }
 
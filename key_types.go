@@ -0,0 +1,168 @@
+package otr3
+
+import (
+	"bufio"
+	"crypto/dsa"
+	"math/big"
+
+	"github.com/coyim/otr3/sexp"
+)
+
+// KeyParameter is a named parameter of a private key, as stored in a libotr private key file
+type KeyParameter struct {
+	Name  string
+	Value *big.Int
+}
+
+// KeyType describes a type of long term key. A key type is identified by the type tag that starts
+// the serialization of its keys, and by the symbol naming it in libotr private key files.
+// Registering a key type makes it available to ParsePrivateKey, ParsePublicKey, GenerateMissingKeys,
+// ImportKeys and ExportKeysToFile.
+type KeyType struct {
+	// Tag is the type tag at the start of serialized keys of this type
+	Tag uint16
+	// Name is the symbol used for keys of this type in libotr private key files, such as "dsa"
+	Name string
+	// NewPrivateKey returns an empty private key of this type, ready to be parsed into or generated
+	NewPrivateKey func() PrivateKey
+	// NewPublicKey returns an empty public key of this type, ready to be parsed into
+	NewPublicKey func() PublicKey
+	// Import creates a private key of this type from the parameters read from a private key file
+	Import func(params []KeyParameter) (PrivateKey, bool)
+	// Export returns the parameters to write to a private key file for a private key of this type
+	Export func(key PrivateKey) []KeyParameter
+}
+
+var errUnregisteredKeyType = newOtrError("the type of the private key is not registered")
+
+// keyTypes holds the registered key types in the order they were registered
+var keyTypes []*KeyType
+
+func init() {
+	RegisterKeyType(KeyType{
+		Tag:           dsaKeyTypeValue,
+		Name:          "dsa",
+		NewPrivateKey: func() PrivateKey { return &DSAPrivateKey{} },
+		NewPublicKey:  func() PublicKey { return &DSAPublicKey{} },
+		Import:        importDSAPrivateKey,
+		Export:        exportDSAParameters,
+	})
+}
+
+// RegisterKeyType makes the given key type available to this package. A key type registered with the same tag as an existing one replaces it.
+// If several key types use the same name, the one registered first is used when reading private key files.
+func RegisterKeyType(kt KeyType) {
+	for i, existing := range keyTypes {
+		if existing.Tag == kt.Tag {
+			keyTypes[i] = &kt
+			return
+		}
+	}
+	keyTypes = append(keyTypes, &kt)
+}
+
+// registeredKeyTypes returns all registered key types, in the order they were registered
+func registeredKeyTypes() []*KeyType {
+	return append([]*KeyType{}, keyTypes...)
+}
+
+func keyTypeWithTag(typeTag uint16) (*KeyType, bool) {
+	for _, kt := range keyTypes {
+		if kt.Tag == typeTag {
+			return kt, true
+		}
+	}
+	return nil, false
+}
+
+func keyTypeForTag(in []byte) (*KeyType, bool) {
+	_, typeTag, ok := ExtractShort(in)
+	if !ok {
+		return nil, false
+	}
+	return keyTypeWithTag(typeTag)
+}
+
+func keyTypeForName(name string) (*KeyType, bool) {
+	for _, kt := range keyTypes {
+		if kt.Name == name {
+			return kt, true
+		}
+	}
+	return nil, false
+}
+
+func keyTypeOf(key PrivateKey) (*KeyType, bool) {
+	return keyTypeForTag(key.PublicKey().Serialize())
+}
+
+func readKeyParameters(r *bufio.Reader) ([]KeyParameter, bool) {
+	var result []KeyParameter
+	for {
+		tag, value, end, ok := readParameter(r)
+		if !ok {
+			return nil, false
+		}
+		if end {
+			return result, true
+		}
+		result = append(result, KeyParameter{tag, value})
+	}
+}
+
+// readTypedPrivateKey reads a list starting with the name of a key type, followed by the parameters of the key
+func readTypedPrivateKey(r *bufio.Reader) (PrivateKey, bool) {
+	sexp.ReadListStart(r)
+	name, ok1 := readPotentialSymbol(r)
+	if !ok1 {
+		return nil, false
+	}
+
+	kt, ok2 := keyTypeForName(name)
+	if !ok2 {
+		return nil, false
+	}
+
+	params, ok3 := readKeyParameters(r)
+	if !ok3 {
+		return nil, false
+	}
+
+	ok4 := sexp.ReadListEnd(r)
+	key, ok5 := kt.Import(params)
+	return key, ok4 && ok5
+}
+
+func dsaPrivateKeyFromParameters(params []KeyParameter) (*dsa.PrivateKey, bool) {
+	k := new(dsa.PrivateKey)
+	for _, p := range params {
+		if !assignParameter(k, p.Name, p.Value) {
+			return nil, false
+		}
+	}
+	return k, true
+}
+
+func importDSAPrivateKey(params []KeyParameter) (PrivateKey, bool) {
+	res, ok := dsaPrivateKeyFromParameters(params)
+	if !ok {
+		return nil, false
+	}
+
+	k := new(DSAPrivateKey)
+	k.PrivateKey = *res
+	k.DSAPublicKey.PublicKey = k.PrivateKey.PublicKey
+	k.lock()
+	return k, true
+}
+
+func exportDSAParameters(key PrivateKey) []KeyParameter {
+	k := key.(*DSAPrivateKey)
+	return []KeyParameter{
+		{"p", k.PrivateKey.P},
+		{"q", k.PrivateKey.Q},
+		{"g", k.PrivateKey.G},
+		{"y", k.PrivateKey.Y},
+		{"x", k.PrivateKey.X},
+	}
+}
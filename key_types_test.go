@@ -0,0 +1,184 @@
+package otr3
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math/big"
+	"testing"
+)
+
+const fakeKeyTypeValue = uint16(0x7A7A)
+
+type fakePublicKey struct {
+	v *big.Int
+}
+
+type fakePrivateKey struct {
+	fakePublicKey
+}
+
+func (pub *fakePublicKey) Parse(in []byte) ([]byte, bool) {
+	index, typeTag, ok := ExtractShort(in)
+	if !ok || typeTag != fakeKeyTypeValue {
+		return in, false
+	}
+	index, pub.v, ok = ExtractMPI(index)
+	return index, ok
+}
+
+func (pub *fakePublicKey) Fingerprint() []byte {
+	return pub.Serialize()
+}
+
+func (pub *fakePublicKey) Verify(hashed, sig []byte) ([]byte, bool) {
+	return sig, false
+}
+
+func (pub *fakePublicKey) Serialize() []byte {
+	return AppendMPI(AppendShort(nil, fakeKeyTypeValue), pub.v)
+}
+
+func (pub *fakePublicKey) IsSame(other PublicKey) bool {
+	oth, ok := other.(*fakePublicKey)
+	return ok && pub.v.Cmp(oth.v) == 0
+}
+
+func (priv *fakePrivateKey) Sign(io.Reader, []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (priv *fakePrivateKey) Generate(io.Reader) error {
+	priv.v = big.NewInt(42)
+	return nil
+}
+
+func (priv *fakePrivateKey) PublicKey() PublicKey {
+	return &priv.fakePublicKey
+}
+
+func (priv *fakePrivateKey) IsAvailableForVersion(uint16) bool {
+	return false
+}
+
+func registerFakeKeyType() func() {
+	RegisterKeyType(KeyType{
+		Tag:           fakeKeyTypeValue,
+		Name:          "fake",
+		NewPrivateKey: func() PrivateKey { return &fakePrivateKey{} },
+		NewPublicKey:  func() PublicKey { return &fakePublicKey{} },
+		Import: func(params []KeyParameter) (PrivateKey, bool) {
+			if len(params) != 1 || params[0].Name != "v" {
+				return nil, false
+			}
+			return &fakePrivateKey{fakePublicKey{params[0].Value}}, true
+		},
+		Export: func(key PrivateKey) []KeyParameter {
+			return []KeyParameter{{"v", key.(*fakePrivateKey).v}}
+		},
+	})
+
+	return func() { unregisterKeyType(fakeKeyTypeValue) }
+}
+
+func unregisterKeyType(tag uint16) {
+	for i, kt := range keyTypes {
+		if kt.Tag == tag {
+			keyTypes = append(keyTypes[:i], keyTypes[i+1:]...)
+			return
+		}
+	}
+}
+
+func Test_ParsePrivateKey_usesRegisteredKeyTypes(t *testing.T) {
+	defer registerFakeKeyType()()
+
+	_, ok, key := ParsePrivateKey(AppendMPI(AppendShort(nil, fakeKeyTypeValue), big.NewInt(5)))
+	assertTrue(t, ok)
+	assertDeepEquals(t, key.(*fakePrivateKey).v, big.NewInt(5))
+}
+
+func Test_ParsePublicKey_usesRegisteredKeyTypes(t *testing.T) {
+	defer registerFakeKeyType()()
+
+	_, ok, key := ParsePublicKey(AppendMPI(AppendShort(nil, fakeKeyTypeValue), big.NewInt(5)))
+	assertTrue(t, ok)
+	assertDeepEquals(t, key.(*fakePublicKey).v, big.NewInt(5))
+}
+
+func Test_ParsePrivateKey_failsForUnknownKeyTypes(t *testing.T) {
+	_, ok, key := ParsePrivateKey(AppendMPI(AppendShort(nil, fakeKeyTypeValue), big.NewInt(5)))
+	assertFalse(t, ok)
+	assertNil(t, key)
+}
+
+func Test_GenerateMissingKeys_generatesKeysForRegisteredKeyTypes(t *testing.T) {
+	defer registerFakeKeyType()()
+
+	res, err := GenerateMissingKeys([][]byte{serializedPrivateKey})
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertDeepEquals(t, res[0].(*fakePrivateKey).v, big.NewInt(42))
+}
+
+func Test_ImportKeys_andExportKeys_useRegisteredKeyTypes(t *testing.T) {
+	defer registerFakeKeyType()()
+
+	acs := []*Account{{Name: "foo", Protocol: "prpl-jabber", Key: &fakePrivateKey{fakePublicKey{big.NewInt(0x1234)}}}}
+
+	var buf bytes.Buffer
+	assertNil(t, exportAccounts(acs, &buf))
+	assertEquals(t, buf.String(), `(privkeys
+  (account
+    (name "foo")
+    (protocol prpl-jabber)
+    (private-key
+      (fake
+        (v #1234#)
+      )
+    )
+  )
+)
+`)
+
+	res, ok := readAccounts(bufio.NewReader(&buf))
+	assertTrue(t, ok)
+	assertDeepEquals(t, res, acs)
+}
+
+func Test_readPrivateKey_failsForUnknownKeyTypes(t *testing.T) {
+	_, ok := readPrivateKey(inp(`(private-key (fake (v #1234#)))`))
+	assertFalse(t, ok)
+}
+
+func Test_exportAccounts_failsForKeysOfAnUnregisteredType(t *testing.T) {
+	acs := []*Account{{Name: "foo", Protocol: "prpl-jabber", Key: &fakePrivateKey{fakePublicKey{big.NewInt(0x1234)}}}}
+
+	var buf bytes.Buffer
+	assertEquals(t, exportAccounts(acs, &buf), errUnregisteredKeyType)
+	assertEquals(t, buf.Len(), 0)
+}
+
+func Test_keyTypeForName_usesTheFirstKeyTypeRegisteredWithTheName(t *testing.T) {
+	defer registerFakeKeyType()()
+	RegisterKeyType(KeyType{Tag: fakeKeyTypeValue + 1, Name: "fake"})
+	defer unregisterKeyType(fakeKeyTypeValue + 1)
+
+	for i := 0; i < 10; i++ {
+		kt, ok := keyTypeForName("fake")
+		assertTrue(t, ok)
+		assertEquals(t, kt.Tag, fakeKeyTypeValue)
+	}
+}
+
+func Test_registeredKeyTypes_returnsTheKeyTypesInRegistrationOrder(t *testing.T) {
+	RegisterKeyType(KeyType{Tag: fakeKeyTypeValue + 1, Name: "later"})
+	defer unregisterKeyType(fakeKeyTypeValue + 1)
+	defer registerFakeKeyType()()
+
+	var tags []uint16
+	for _, kt := range registeredKeyTypes() {
+		tags = append(tags, kt.Tag)
+	}
+	assertDeepEquals(t, tags, []uint16{dsaKeyTypeValue, fakeKeyTypeValue + 1, fakeKeyTypeValue})
+}
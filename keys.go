@@ -8,7 +8,6 @@ import (
 	"crypto/dsa"
 	"crypto/rand"
 	"encoding/hex"
-	"fmt"
 	"io"
 	"math/big"
 	"os"
@@ -34,8 +33,7 @@ type PublicKey interface {
 	Parse([]byte) ([]byte, bool)
 	Fingerprint() []byte
 	Verify([]byte, []byte) ([]byte, bool)
-
-	serialize() []byte
+	Serialize() []byte
 
 	IsSame(PublicKey) bool
 }
@@ -50,25 +48,28 @@ type PrivateKey interface {
 	IsAvailableForVersion(uint16) bool
 }
 
-// GenerateMissingKeys will look through the existing serialized keys and generate new keys to ensure that the functioning of this version of OTR will work correctly. It will only return the newly generated keys, not the old ones
+// GenerateMissingKeys will look through the existing serialized keys and generate new keys to ensure that the functioning of this version of OTR will work correctly. A key is generated for every registered key type that has no existing key. It will only return the newly generated keys, not the old ones
 func GenerateMissingKeys(existing [][]byte) ([]PrivateKey, error) {
 	var result []PrivateKey
-	hasDSA := false
+	has := make(map[uint16]bool)
 
 	for _, x := range existing {
 		_, typeTag, ok := ExtractShort(x)
-		if ok && typeTag == dsaKeyTypeValue {
-			hasDSA = true
+		if ok {
+			has[typeTag] = true
 		}
 	}
 
-	if !hasDSA {
-		var priv DSAPrivateKey
+	for _, kt := range registeredKeyTypes() {
+		if has[kt.Tag] {
+			continue
+		}
+
+		priv := kt.NewPrivateKey()
 		if err := priv.Generate(rand.Reader); err != nil {
 			return nil, err
 		}
-		priv.lock()
-		result = append(result, &priv)
+		result = append(result, priv)
 	}
 
 	return result, nil
@@ -153,7 +154,15 @@ func ExportKeysToFile(acs []*Account, fname string) error {
 	if err != nil {
 		return err
 	}
-	exportAccounts(acs, f)
+	bw := bufio.NewWriter(f)
+	if err := exportAccounts(acs, bw); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
 	return f.Close()
 }
 
@@ -234,37 +243,11 @@ func readAccount(r *bufio.Reader) (a *Account, ok bool, atEnd bool) {
 func readPrivateKey(r *bufio.Reader) (PrivateKey, bool) {
 	sexp.ReadListStart(r)
 	ok1 := readSymbolAndExpect(r, "private-key")
-	k := new(DSAPrivateKey)
-	res, ok2 := readDSAPrivateKey(r)
-	if ok2 {
-		k.PrivateKey = *res
-		k.DSAPublicKey.PublicKey = k.PrivateKey.PublicKey
-		k.lock()
-	}
+	k, ok2 := readTypedPrivateKey(r)
 	ok3 := sexp.ReadListEnd(r)
 	return k, ok1 && ok2 && ok3
 }
 
-func readDSAPrivateKey(r *bufio.Reader) (*dsa.PrivateKey, bool) {
-	sexp.ReadListStart(r)
-	ok1 := readSymbolAndExpect(r, "dsa")
-	k := new(dsa.PrivateKey)
-	for {
-		tag, value, end, ok := readParameter(r)
-		if !ok {
-			return nil, false
-		}
-		if end {
-			break
-		}
-		if !assignParameter(k, tag, value) {
-			return nil, false
-		}
-	}
-	ok2 := sexp.ReadListEnd(r)
-	return k, ok1 && ok2
-}
-
 func readParameter(r *bufio.Reader) (tag string, value *big.Int, end bool, ok bool) {
 	if !sexp.ReadListStart(r) {
 		return "", nil, true, true
@@ -298,9 +281,8 @@ func ParsePrivateKey(in []byte) (index []byte, ok bool, key PrivateKey) {
 		return in, false, nil
 	}
 
-	switch typeTag {
-	case dsaKeyTypeValue:
-		key = &DSAPrivateKey{}
+	if kt, known := keyTypeWithTag(typeTag); known {
+		key = kt.NewPrivateKey()
 		index, ok = key.Parse(in)
 		return
 	}
@@ -316,9 +298,8 @@ func ParsePublicKey(in []byte) (index []byte, ok bool, key PublicKey) {
 		return in, false, nil
 	}
 
-	switch typeTag {
-	case dsaKeyTypeValue:
-		key = &DSAPublicKey{}
+	if kt, known := keyTypeWithTag(typeTag); known {
+		key = kt.NewPublicKey()
 		index, ok = key.Parse(in)
 		return
 	}
@@ -374,6 +355,11 @@ func (priv *DSAPrivateKey) Serialize() []byte {
 	return priv.serialize()
 }
 
+// Serialize will return the serialization of the public key to a byte array
+func (pub *DSAPublicKey) Serialize() []byte {
+	return pub.serialize()
+}
+
 func (pub *DSAPublicKey) serialize() []byte {
 	if pub.P == nil || pub.Q == nil || pub.G == nil || pub.Y == nil {
 		return nil
@@ -527,67 +513,56 @@ func notHex(r rune) bool {
 	return true
 }
 
-func exportName(n string, w *bufio.Writer) {
-	indent := "    "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(name \"")
-	_, _ = w.WriteString(n)
-	_, _ = w.WriteString("\")\n")
-}
-
-func exportProtocol(n string, w *bufio.Writer) {
-	indent := "    "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(protocol ")
-	_, _ = w.WriteString(n)
-	_, _ = w.WriteString(")\n")
-}
-
-func exportPrivateKey(key PrivateKey, w *bufio.Writer) {
-	indent := "    "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(private-key\n")
-	exportDSAPrivateKey(key.(*DSAPrivateKey), w)
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString(")\n")
-}
-
-func exportDSAPrivateKey(key *DSAPrivateKey, w *bufio.Writer) {
-	indent := "      "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(dsa\n")
-	exportParameter("p", key.PrivateKey.P, w)
-	exportParameter("q", key.PrivateKey.Q, w)
-	exportParameter("g", key.PrivateKey.G, w)
-	exportParameter("y", key.PrivateKey.Y, w)
-	exportParameter("x", key.PrivateKey.X, w)
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString(")\n")
-}
-
-func exportParameter(name string, val *big.Int, w *bufio.Writer) {
-	indent := "        "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString(fmt.Sprintf("(%s #%X#)\n", name, val))
-}
-
-func exportAccount(a *Account, w *bufio.Writer) {
-	indent := "  "
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString("(account\n")
-	exportName(a.Name, w)
-	exportProtocol(a.Protocol, w)
-	exportPrivateKey(a.Key, w)
-	_, _ = w.WriteString(indent)
-	_, _ = w.WriteString(")\n")
-}
-
-func exportAccounts(as []*Account, w io.Writer) {
-	bw := bufio.NewWriter(w)
-	_, _ = bw.WriteString("(privkeys\n")
+func exportName(n string) sexp.Value {
+	return sexp.List(sexp.Symbol("name"), sexp.Sstring(n))
+}
+
+func exportProtocol(n string) sexp.Value {
+	return sexp.List(sexp.Symbol("protocol"), sexp.Symbol(n))
+}
+
+func exportPrivateKey(key PrivateKey) (sexp.Value, error) {
+	kt, ok := keyTypeOf(key)
+	if !ok {
+		return nil, errUnregisteredKeyType
+	}
+	return sexp.List(sexp.Symbol("private-key"), exportTypedPrivateKey(kt, key)), nil
+}
+
+func exportTypedPrivateKey(kt *KeyType, key PrivateKey) sexp.Value {
+	values := []sexp.Value{sexp.Symbol(kt.Name)}
+	for _, p := range kt.Export(key) {
+		values = append(values, exportParameter(p.Name, p.Value))
+	}
+	return sexp.List(values...)
+}
+
+func exportParameter(name string, val *big.Int) sexp.Value {
+	return sexp.List(sexp.Symbol(name), sexp.NewBigNumFromInt(val))
+}
+
+func exportAccount(a *Account) (sexp.Value, error) {
+	key, err := exportPrivateKey(a.Key)
+	if err != nil {
+		return nil, err
+	}
+	return sexp.List(sexp.Symbol("account"), exportName(a.Name), exportProtocol(a.Protocol), key), nil
+}
+
+func exportAccounts(as []*Account, w io.Writer) error {
+	values := []sexp.Value{sexp.Symbol("privkeys")}
 	for _, a := range as {
-		exportAccount(a, bw)
+		v, err := exportAccount(a)
+		if err != nil {
+			return err
+		}
+		values = append(values, v)
+	}
+
+	// Nothing is buffered here, so that the caller controls every copy of the private keys
+	if err := sexp.WritePretty(w, sexp.List(values...)); err != nil {
+		return err
 	}
-	_, _ = bw.WriteString(")\n")
-	_ = bw.Flush()
+	_, err := io.WriteString(w, "\n")
+	return err
 }
@@ -97,7 +97,7 @@ func Test_readParameter_willReturnNotOKIfAskedToParseSomethingOfTheWrongType(t *
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnADSAPrivateKey(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnADSAPrivateKey(t *testing.T) {
 	from := inp(`(dsa
   (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
@@ -105,28 +105,29 @@ func Test_readDSAPrivateKey_willReturnADSAPrivateKey(t *testing.T) {
   (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
   (x #14D0345A3562C480A039E3C72764F72D79043216#)
   )`)
-	k, ok := readDSAPrivateKey(from)
-	assertDeepEquals(t, k.P, bnFromHex("00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857"))
-	assertDeepEquals(t, k.Q, bnFromHex("00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081"))
-	assertDeepEquals(t, k.G, bnFromHex("535E360E8A95EBA46A4F7DE50AD6E9B2A6DB785A66B64EB9F20338D2A3E8FB0E94725848F1AA6CC567CB83A1CC517EC806F2E92EAE71457E80B2210A189B91250779434B41FC8A8873F6DB94BEA7D177F5D59E7E114EE10A49CFD9CEF88AE43387023B672927BA74B04EB6BBB5E57597766A2F9CE3857D7ACE3E1E3BC1FC6F26"))
-	assertDeepEquals(t, k.X, bnFromHex("14D0345A3562C480A039E3C72764F72D79043216"))
-	assertDeepEquals(t, k.Y, bnFromHex("0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF"))
+	k, ok := readTypedPrivateKey(from)
+	dk := k.(*DSAPrivateKey)
+	assertDeepEquals(t, dk.PrivateKey.P, bnFromHex("00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857"))
+	assertDeepEquals(t, dk.PrivateKey.Q, bnFromHex("00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081"))
+	assertDeepEquals(t, dk.PrivateKey.G, bnFromHex("535E360E8A95EBA46A4F7DE50AD6E9B2A6DB785A66B64EB9F20338D2A3E8FB0E94725848F1AA6CC567CB83A1CC517EC806F2E92EAE71457E80B2210A189B91250779434B41FC8A8873F6DB94BEA7D177F5D59E7E114EE10A49CFD9CEF88AE43387023B672927BA74B04EB6BBB5E57597766A2F9CE3857D7ACE3E1E3BC1FC6F26"))
+	assertDeepEquals(t, dk.PrivateKey.X, bnFromHex("14D0345A3562C480A039E3C72764F72D79043216"))
+	assertDeepEquals(t, dk.PrivateKey.Y, bnFromHex("0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF"))
 	assertDeepEquals(t, ok, true)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKForNoList(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKForNoList(t *testing.T) {
 	from := inp(`dsa`)
-	_, ok := readDSAPrivateKey(from)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKForListWithNoEntries(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKForListWithNoEntries(t *testing.T) {
 	from := inp(`()`)
-	_, ok := readDSAPrivateKey(from)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKForListWithNoEnding(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKForListWithNoEnding(t *testing.T) {
 	from := inp(`(dsa
   (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
@@ -134,11 +135,11 @@ func Test_readDSAPrivateKey_willReturnNotOKForListWithNoEnding(t *testing.T) {
   (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
   (x #14D0345A3562C480A039E3C72764F72D79043216#)
   `)
-	_, ok := readDSAPrivateKey(from)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKForListWithTheWrongTag(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKForListWithTheWrongTag(t *testing.T) {
 	from := inp(`(dsax
   (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
@@ -146,11 +147,11 @@ func Test_readDSAPrivateKey_willReturnNotOKForListWithTheWrongTag(t *testing.T)
   (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
   (x #14D0345A3562C480A039E3C72764F72D79043216#)
   `)
-	_, ok := readDSAPrivateKey(from)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKForListWithInvalidTypeOfTag(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKForListWithInvalidTypeOfTag(t *testing.T) {
 	from := inp(`("dsa"
   (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
@@ -158,67 +159,67 @@ func Test_readDSAPrivateKey_willReturnNotOKForListWithInvalidTypeOfTag(t *testin
   (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
   (x #14D0345A3562C480A039E3C72764F72D79043216#)
   `)
-	_, ok := readDSAPrivateKey(from)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKWhenPParameterIsInvalid(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKWhenPParameterIsInvalid(t *testing.T) {
 	from := inp(`(dsa
   (px #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
   (g #535E360E8A95EBA46A4F7DE50AD6E9B2A6DB785A66B64EB9F20338D2A3E8FB0E94725848F1AA6CC567CB83A1CC517EC806F2E92EAE71457E80B2210A189B91250779434B41FC8A8873F6DB94BEA7D177F5D59E7E114EE10A49CFD9CEF88AE43387023B672927BA74B04EB6BBB5E57597766A2F9CE3857D7ACE3E1E3BC1FC6F26#)
   (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
-  (x #14D0345A3562C480A039E3C72764F72D79043216#))
-  `)
-	_, ok := readDSAPrivateKey(from)
+  (x #14D0345A3562C480A039E3C72764F72D79043216#)
+  )`)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKWhenQParameterIsInvalid(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKWhenQParameterIsInvalid(t *testing.T) {
 	from := inp(`(dsa
   (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (qx #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
   (g #535E360E8A95EBA46A4F7DE50AD6E9B2A6DB785A66B64EB9F20338D2A3E8FB0E94725848F1AA6CC567CB83A1CC517EC806F2E92EAE71457E80B2210A189B91250779434B41FC8A8873F6DB94BEA7D177F5D59E7E114EE10A49CFD9CEF88AE43387023B672927BA74B04EB6BBB5E57597766A2F9CE3857D7ACE3E1E3BC1FC6F26#)
   (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
-  (x #14D0345A3562C480A039E3C72764F72D79043216#))
-  `)
-	_, ok := readDSAPrivateKey(from)
+  (x #14D0345A3562C480A039E3C72764F72D79043216#)
+  )`)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKWhenGParameterIsInvalid(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKWhenGParameterIsInvalid(t *testing.T) {
 	from := inp(`(dsa
   (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
   (gx #535E360E8A95EBA46A4F7DE50AD6E9B2A6DB785A66B64EB9F20338D2A3E8FB0E94725848F1AA6CC567CB83A1CC517EC806F2E92EAE71457E80B2210A189B91250779434B41FC8A8873F6DB94BEA7D177F5D59E7E114EE10A49CFD9CEF88AE43387023B672927BA74B04EB6BBB5E57597766A2F9CE3857D7ACE3E1E3BC1FC6F26#)
   (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
-  (x #14D0345A3562C480A039E3C72764F72D79043216#))
-  `)
-	_, ok := readDSAPrivateKey(from)
+  (x #14D0345A3562C480A039E3C72764F72D79043216#)
+  )`)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKWhenYParameterIsInvalid(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKWhenYParameterIsInvalid(t *testing.T) {
 	from := inp(`(dsa
   (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
   (g #535E360E8A95EBA46A4F7DE50AD6E9B2A6DB785A66B64EB9F20338D2A3E8FB0E94725848F1AA6CC567CB83A1CC517EC806F2E92EAE71457E80B2210A189B91250779434B41FC8A8873F6DB94BEA7D177F5D59E7E114EE10A49CFD9CEF88AE43387023B672927BA74B04EB6BBB5E57597766A2F9CE3857D7ACE3E1E3BC1FC6F26#)
   (yx #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
-  (x #14D0345A3562C480A039E3C72764F72D79043216#))
-  `)
-	_, ok := readDSAPrivateKey(from)
+  (x #14D0345A3562C480A039E3C72764F72D79043216#)
+  )`)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
-func Test_readDSAPrivateKey_willReturnNotOKWhenXParameterIsInvalid(t *testing.T) {
+func Test_readTypedPrivateKey_willReturnNotOKWhenXParameterIsInvalid(t *testing.T) {
 	from := inp(`(dsa
   (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
   (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
   (g #535E360E8A95EBA46A4F7DE50AD6E9B2A6DB785A66B64EB9F20338D2A3E8FB0E94725848F1AA6CC567CB83A1CC517EC806F2E92EAE71457E80B2210A189B91250779434B41FC8A8873F6DB94BEA7D177F5D59E7E114EE10A49CFD9CEF88AE43387023B672927BA74B04EB6BBB5E57597766A2F9CE3857D7ACE3E1E3BC1FC6F26#)
   (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
-  (xx #14D0345A3562C480A039E3C72764F72D79043216#))
-  `)
-	_, ok := readDSAPrivateKey(from)
+  (xx #14D0345A3562C480A039E3C72764F72D79043216#)
+  )`)
+	_, ok := readTypedPrivateKey(from)
 	assertDeepEquals(t, ok, false)
 }
 
@@ -1080,3 +1081,15 @@ func Test_ExportKeysToFile_returnsAnErrorIfSomethingGoesWrong(t *testing.T) {
 	err := ExportKeysToFile([]*Account{acc}, "non_existing_directory/test_export_of_keys.blah")
 	assertMatches(t, err.Error(), "open non_existing_directory/test_export_of_keys.blah: (no such file or directory|The system cannot find the path specified.)")
 }
+
+func Test_exportAccounts_escapesAccountNames(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	acc := &Account{Name: "hello \"there\"", Protocol: "go-xmpp", Key: priv}
+	bt := bytes.NewBuffer(make([]byte, 0, 200))
+	exportAccounts([]*Account{acc}, bt)
+
+	res, err := ImportKeys(bt)
+	assertNil(t, err)
+	assertEquals(t, res[0].Name, "hello \"there\"")
+}
@@ -0,0 +1,73 @@
+package otr3
+
+import "fmt"
+
+// Logger receives structured records about what happens in a conversation: AKE transitions, SMP steps, key rotations,
+// fragments and policy decisions. The arguments are alternating keys and values, in the same way as for the log/slog package,
+// so a *slog.Logger can be used directly. Every record carries our and their instance tags and the SSID.
+// Records never contain secret material such as keys, SMP secrets or the content of messages.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// SetLogger assigns the logger that receives records about this conversation
+func (c *Conversation) SetLogger(l Logger) {
+	c.logger = l
+}
+
+func (c *Conversation) logContext(args []interface{}) []interface{} {
+	return append(args,
+		"our_instance", fmt.Sprintf("%08X", c.ourInstanceTag),
+		"their_instance", fmt.Sprintf("%08X", c.theirInstanceTag),
+		"ssid", fmt.Sprintf("%X", c.ssid),
+	)
+}
+
+func (c *Conversation) logDebug(msg string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Debug(msg, c.logContext(args)...)
+	}
+}
+
+func (c *Conversation) logInfo(msg string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Info(msg, c.logContext(args)...)
+	}
+}
+
+func (c *Conversation) logWarn(msg string, args ...interface{}) {
+	if c.logger != nil {
+		c.logger.Warn(msg, c.logContext(args)...)
+	}
+}
+
+func (c *Conversation) akeStateName() string {
+	if c.ake == nil || c.ake.state == nil {
+		return authStateNone{}.identityString()
+	}
+	return c.ake.state.identityString()
+}
+
+func (c *Conversation) smpStateName() string {
+	if c.smp.state == nil {
+		return smpStateExpect1{}.identityString()
+	}
+	return c.smp.state.identityString()
+}
+
+func akeMessageName(msgType byte) string {
+	switch msgType {
+	case msgTypeDHCommit:
+		return "DH-Commit"
+	case msgTypeDHKey:
+		return "DH-Key"
+	case msgTypeRevealSig:
+		return "Reveal-Signature"
+	case msgTypeSig:
+		return "Signature"
+	}
+	return fmt.Sprintf("unknown (0x%X)", msgType)
+}
@@ -0,0 +1,106 @@
+package otr3
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type logRecord struct {
+	level string
+	msg   string
+	args  []interface{}
+}
+
+type recordingLogger struct {
+	records []logRecord
+}
+
+func (l *recordingLogger) record(level, msg string, args []interface{}) {
+	l.records = append(l.records, logRecord{level, msg, args})
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.record("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.record("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.record("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.record("ERROR", msg, args) }
+
+func (l *recordingLogger) messages() []string {
+	var ret []string
+	for _, r := range l.records {
+		ret = append(ret, r.msg)
+	}
+	return ret
+}
+
+func (l *recordingLogger) has(msg string) bool {
+	for _, r := range l.records {
+		if r.msg == msg {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_Logger_receivesRecordsForTheProtocolWithoutSecrets(t *testing.T) {
+	aliceLog, bobLog := &recordingLogger{}, &recordingLogger{}
+
+	alice, bob := fixtureConversationPair()
+	alice.SetLogger(aliceLog)
+	bob.SetLogger(bobLog)
+
+	exchangeAll(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	assertTrue(t, alice.IsEncrypted())
+
+	for i := 0; i < 2; i++ {
+		toSend, _ := alice.Send(ValidMessage("a very secret message"))
+		exchangeAll(t, alice, bob, toSend)
+		toSend, _ = bob.Send(ValidMessage("another very secret message"))
+		exchangeAll(t, bob, alice, toSend)
+	}
+
+	toSend, err := alice.StartAuthenticate("", []byte("the shared smp secret"))
+	assertNil(t, err)
+	exchangeAll(t, alice, bob, toSend)
+	toSend, err = bob.ProvideAuthenticationSecret([]byte("the shared smp secret"))
+	assertNil(t, err)
+	exchangeAll(t, bob, alice, toSend)
+
+	bob.SetFragmentSize(200)
+	toSend, _ = bob.Send(ValidMessage("a secret that needs fragments"))
+	exchangeAll(t, bob, alice, toSend)
+
+	for _, m := range []string{"version chosen", "AKE started", "AKE transition", "AKE finished", "keys rotated", "SMP started", "SMP step", "fragment received"} {
+		assertTrue(t, aliceLog.has(m) || bobLog.has(m))
+	}
+	assertTrue(t, bobLog.has("message fragmented"))
+
+	for _, r := range append(aliceLog.records, bobLog.records...) {
+		text := fmt.Sprint(r.args...)
+		assertFalse(t, strings.Contains(text, "secret"))
+		assertTrue(t, strings.Contains(fmt.Sprint(r.args), "our_instance"))
+		assertTrue(t, strings.Contains(fmt.Sprint(r.args), "their_instance"))
+		assertTrue(t, strings.Contains(fmt.Sprint(r.args), "ssid"))
+		assertEquals(t, len(r.args)%2, 0)
+	}
+}
+
+func Test_Logger_recordsPolicyDecisions(t *testing.T) {
+	l := &recordingLogger{}
+	c := &Conversation{Policies: PolicyAlways}
+	c.SetLogger(l)
+
+	_, _ = c.Send(ValidMessage("hello"))
+	_, _, _ = c.Receive(ValidMessage("hi"))
+
+	assertDeepEquals(t, l.messages(), []string{
+		"message queued until encrypted, as required by policy",
+		"unencrypted message received",
+	})
+}
+
+func Test_Logger_isOptional(t *testing.T) {
+	c := &Conversation{Policies: PolicyAlways}
+	_, err := c.Send(ValidMessage("hello"))
+	assertNil(t, err)
+}
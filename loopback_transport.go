@@ -0,0 +1,129 @@
+package otr3
+
+import "math/rand"
+
+// LoopbackOptions decides how unreliable a LoopbackNetwork is. All rates are probabilities between 0 and 1.
+type LoopbackOptions struct {
+	// DropRate is the probability that a message is never delivered
+	DropRate float64
+	// DuplicateRate is the probability that a message is delivered twice
+	DuplicateRate float64
+	// ReorderRate is the probability that a message is delivered before messages sent earlier than it
+	ReorderRate float64
+}
+
+type loopbackMessage struct {
+	to  *LoopbackTransport
+	msg ValidMessage
+}
+
+// LoopbackNetwork is an in-memory network connecting pairs of LoopbackTransports. Messages sent on a transport
+// are queued until Deliver is called. The network can simulate lost, duplicated and reordered messages,
+// using a pseudo random generator with a fixed seed so that every run behaves the same.
+type LoopbackNetwork struct {
+	options LoopbackOptions
+	rand    *rand.Rand
+	queue   []loopbackMessage
+
+	dropped, duplicated, delivered int
+}
+
+// LoopbackTransport is one end of a connection in a LoopbackNetwork
+type LoopbackTransport struct {
+	network  *LoopbackNetwork
+	peer     *LoopbackTransport
+	receiver func(ValidMessage)
+}
+
+// NewLoopbackNetwork creates a new network with the given options, seeding its randomness with the given seed
+func NewLoopbackNetwork(options LoopbackOptions, seed int64) *LoopbackNetwork {
+	return &LoopbackNetwork{
+		options: options,
+		/* #nosec G404*/
+		rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Pair returns two transports connected to each other
+func (n *LoopbackNetwork) Pair() (*LoopbackTransport, *LoopbackTransport) {
+	a := &LoopbackTransport{network: n}
+	b := &LoopbackTransport{network: n, peer: a}
+	a.peer = b
+	return a, b
+}
+
+// SetReceiver sets the function called with every message delivered to this transport
+func (t *LoopbackTransport) SetReceiver(receiver func(ValidMessage)) {
+	t.receiver = receiver
+}
+
+// Send queues the message for delivery to the other end of the connection
+func (t *LoopbackTransport) Send(msg ValidMessage) error {
+	t.network.queue = append(t.network.queue, loopbackMessage{t.peer, makeCopy(msg)})
+	return nil
+}
+
+// Pending returns the number of messages waiting to be delivered
+func (n *LoopbackNetwork) Pending() int {
+	return len(n.queue)
+}
+
+// Dropped returns the number of messages the network has lost
+func (n *LoopbackNetwork) Dropped() int {
+	return n.dropped
+}
+
+// Duplicated returns the number of messages the network has delivered twice
+func (n *LoopbackNetwork) Duplicated() int {
+	return n.duplicated
+}
+
+// Delivered returns the number of messages the network has delivered, counting every duplicate
+func (n *LoopbackNetwork) Delivered() int {
+	return n.delivered
+}
+
+func (n *LoopbackNetwork) happens(rate float64) bool {
+	return rate > 0 && n.rand.Float64() < rate
+}
+
+// DeliverOne delivers the next message in the queue, and returns false if there were no messages to deliver
+func (n *LoopbackNetwork) DeliverOne() bool {
+	if len(n.queue) == 0 {
+		return false
+	}
+
+	ix := 0
+	if len(n.queue) > 1 && n.happens(n.options.ReorderRate) {
+		ix = 1 + n.rand.Intn(len(n.queue)-1)
+	}
+
+	m := n.queue[ix]
+	n.queue = append(n.queue[:ix], n.queue[ix+1:]...)
+
+	if n.happens(n.options.DropRate) {
+		n.dropped++
+		return true
+	}
+
+	n.deliver(m)
+	if n.happens(n.options.DuplicateRate) {
+		n.duplicated++
+		n.deliver(m)
+	}
+
+	return true
+}
+
+// Deliver delivers messages until the queue is empty, including all messages sent in response to delivered messages
+func (n *LoopbackNetwork) Deliver() {
+	for n.DeliverOne() {
+	}
+}
+
+func (n *LoopbackNetwork) deliver(m loopbackMessage) {
+	n.delivered++
+	if m.to.receiver != nil {
+		m.to.receiver(makeCopy(m.msg))
+	}
+}
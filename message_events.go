@@ -56,6 +56,21 @@ const (
 
 	// MessageEventReceivedMessageForOtherInstance is triggered when we receive and discard a message for another instance
 	MessageEventReceivedMessageForOtherInstance
+
+	// MessageEventReceivedMessageReplayed is triggered when we receive and discard a data message we have already received
+	MessageEventReceivedMessageReplayed
+
+	// MessageEventMessageExpired is signaled when a queued message is dropped without having been sent, because the
+	// encrypted session wasn't established in time or because too many messages were queued
+	MessageEventMessageExpired
+
+	// MessageEventFragmentsExpired is signaled when a partially received fragmented message is dropped, because
+	// its remaining fragments didn't arrive in time
+	MessageEventFragmentsExpired
+
+	// MessageEventFragmentsAbandoned is signaled when a partially received fragmented message is dropped, because
+	// it grew too large or because the fragments of other messages needed the memory
+	MessageEventFragmentsAbandoned
 )
 
 // MessageEventHandler handles MessageEvents
@@ -73,12 +88,14 @@ func (d dynamicMessageEventHandler) HandleMessageEvent(event MessageEvent, messa
 }
 
 func (c *Conversation) messageEvent(e MessageEvent, trace ...interface{}) {
+	c.metricsForMessageEvent(e, nil)
 	if c.messageEventHandler != nil {
 		c.messageEventHandler.HandleMessageEvent(e, nil, nil, trace...)
 	}
 }
 
 func (c *Conversation) messageEventWithError(e MessageEvent, err error) {
+	c.metricsForMessageEvent(e, err)
 	if c.messageEventHandler != nil {
 		c.messageEventHandler.HandleMessageEvent(e, nil, err)
 	}
@@ -125,6 +142,14 @@ func (s MessageEvent) String() string {
 		return "MessageEventReceivedMessageUnrecognized"
 	case MessageEventReceivedMessageForOtherInstance:
 		return "MessageEventReceivedMessageForOtherInstance"
+	case MessageEventReceivedMessageReplayed:
+		return "MessageEventReceivedMessageReplayed"
+	case MessageEventMessageExpired:
+		return "MessageEventMessageExpired"
+	case MessageEventFragmentsExpired:
+		return "MessageEventFragmentsExpired"
+	case MessageEventFragmentsAbandoned:
+		return "MessageEventFragmentsAbandoned"
 	default:
 		return "MESSAGE EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -18,6 +18,10 @@ func Test_MessageEvent_hasValidStringImplementation(t *testing.T) {
 	assertEquals(t, MessageEventReceivedMessageUnencrypted.String(), "MessageEventReceivedMessageUnencrypted")
 	assertEquals(t, MessageEventReceivedMessageUnrecognized.String(), "MessageEventReceivedMessageUnrecognized")
 	assertEquals(t, MessageEventReceivedMessageForOtherInstance.String(), "MessageEventReceivedMessageForOtherInstance")
+	assertEquals(t, MessageEventReceivedMessageReplayed.String(), "MessageEventReceivedMessageReplayed")
+	assertEquals(t, MessageEventMessageExpired.String(), "MessageEventMessageExpired")
+	assertEquals(t, MessageEventFragmentsExpired.String(), "MessageEventFragmentsExpired")
+	assertEquals(t, MessageEventFragmentsAbandoned.String(), "MessageEventFragmentsAbandoned")
 	assertEquals(t, MessageEvent(20000).String(), "MESSAGE EVENT: (THIS SHOULD NEVER HAPPEN)")
 }
 
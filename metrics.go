@@ -0,0 +1,257 @@
+package otr3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements of how conversations behave. The same Metrics can be shared by many conversations,
+// so implementations must be safe for concurrent use.
+type Metrics interface {
+	// AKEFinished is called when an AKE has finished successfully, with the time it took
+	AKEFinished(version uint16, duration time.Duration)
+	// AKEFailed is called when the AKE couldn't continue, with the reason why. The reason is one of a fixed set:
+	// "signature", "mac", "dh_value", "version", "cancelled" or "other"
+	AKEFailed(reason string)
+	// SMPSucceeded is called when an SMP run proved that both sides have the same secret
+	SMPSucceeded()
+	// SMPFailed is called when an SMP run ended without success, with the event that ended it
+	SMPFailed(reason SMPEvent)
+	// FragmentsSent is called when a message has been split into fragments
+	FragmentsSent(fragments int)
+	// FragmentsReassembled is called when a message has been put together from the fragments received
+	FragmentsReassembled(fragments int)
+	// HeartbeatSent is called when a heartbeat has been sent
+	HeartbeatSent()
+	// MessageRetransmitted is called for every message sent again because the peer couldn't read it
+	MessageRetransmitted()
+	// MessageError is called when a message couldn't be encrypted or we received a message that couldn't be read
+	MessageError(code ErrorCode)
+}
+
+// SetMetrics assigns the metrics that will receive measurements for this conversation
+func (c *Conversation) SetMetrics(m Metrics) {
+	c.metrics = m
+}
+
+func (c *Conversation) metricsForMessageEvent(e MessageEvent, err error) {
+	if c.metrics == nil {
+		return
+	}
+
+	switch e {
+	case MessageEventSetupError:
+		c.metrics.AKEFailed(akeFailureReason(err))
+	case MessageEventLogHeartbeatSent:
+		c.metrics.HeartbeatSent()
+	case MessageEventMessageResent:
+		c.metrics.MessageRetransmitted()
+	}
+}
+
+var akeFailureReasons = map[error]string{
+	errCorruptEncryptedSignature:                              "signature",
+	newOtrError("bad signature in encrypted signature"):       "signature",
+	newOtrError("bad signature MAC in encrypted signature"):   "mac",
+	newOtrError("bad commit MAC in reveal signature message"): "mac",
+	newOtrError("DH value out of range"):                      "dh_value",
+	newOtrError("gx corrupt after decryption"):                "dh_value",
+	errInvalidVersion:        "version",
+	errUnsupportedOTRVersion: "version",
+	errWrongProtocolVersion:  "version",
+}
+
+// akeFailureReason maps the error that stopped the AKE to one of a fixed set of reasons,
+// so the error messages can't grow the number of metrics without bound
+func akeFailureReason(err error) string {
+	if isContextError(err) {
+		return "cancelled"
+	}
+	if oe, ok := err.(OtrError); ok {
+		if reason, ok := akeFailureReasons[oe]; ok {
+			return reason
+		}
+	}
+	return "other"
+}
+
+func (c *Conversation) metricsForSMPEvent(e SMPEvent) {
+	if c.metrics == nil {
+		return
+	}
+
+	switch e {
+	case SMPEventSuccess:
+		c.metrics.SMPSucceeded()
+	case SMPEventError, SMPEventAbort, SMPEventCheated, SMPEventFailure:
+		c.metrics.SMPFailed(e)
+	}
+}
+
+func (c *Conversation) metricsForAKEFinished() {
+	if c.metrics == nil || c.ake == nil || c.ake.started.IsZero() {
+		return
+	}
+
+	c.metrics.AKEFinished(c.version.protocolVersion(), time.Since(c.ake.started))
+}
+
+// PrometheusMetrics is a Metrics that keeps counters, which can be written in the Prometheus text exposition format.
+// The AKE duration is kept as a summary with a sum and a count per version.
+type PrometheusMetrics struct {
+	namespace string
+
+	lock     sync.Mutex
+	counters map[string]float64
+	families map[string]string
+}
+
+type prometheusFamily struct {
+	kind, help string
+}
+
+var prometheusFamilies = map[string]prometheusFamily{
+	"ake_duration_seconds":         {"summary", "Time taken by the AKEs that finished, by protocol version."},
+	"ake_failures_total":           {"counter", "AKEs that couldn't continue, by reason."},
+	"smp_successes_total":          {"counter", "SMP runs that proved both sides have the same secret."},
+	"smp_failures_total":           {"counter", "SMP runs that ended without success, by the event that ended them."},
+	"fragments_sent_total":         {"counter", "Fragments sent."},
+	"fragments_reassembled_total":  {"counter", "Fragments put together into messages."},
+	"heartbeats_sent_total":        {"counter", "Heartbeats sent."},
+	"messages_retransmitted_total": {"counter", "Messages sent again because the peer couldn't read them."},
+	"message_errors_total":         {"counter", "Messages that couldn't be encrypted or read, by error code."},
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics where all metric names start with the given namespace
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	return &PrometheusMetrics{
+		namespace: namespace,
+		counters:  make(map[string]float64),
+		families:  make(map[string]string),
+	}
+}
+
+func (p *PrometheusMetrics) key(name string, labels []string) string {
+	key := p.namespace + "_" + name
+	if len(labels) == 0 {
+		return key
+	}
+
+	var ls []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		ls = append(ls, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return key + "{" + strings.Join(ls, ",") + "}"
+}
+
+func (p *PrometheusMetrics) add(name string, v float64, labels ...string) {
+	p.addTo(name, name, v, labels...)
+}
+
+// addTo adds to the named sample of the given metric family, which is only different from the name for summaries
+func (p *PrometheusMetrics) addTo(family, name string, v float64, labels ...string) {
+	key := p.key(name, labels)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.counters[key] += v
+	p.families[key] = family
+}
+
+// AKEFinished implements Metrics
+func (p *PrometheusMetrics) AKEFinished(version uint16, duration time.Duration) {
+	v := fmt.Sprintf("%d", version)
+	p.addTo("ake_duration_seconds", "ake_duration_seconds_sum", duration.Seconds(), "version", v)
+	p.addTo("ake_duration_seconds", "ake_duration_seconds_count", 1, "version", v)
+}
+
+// AKEFailed implements Metrics
+func (p *PrometheusMetrics) AKEFailed(reason string) {
+	p.add("ake_failures_total", 1, "reason", reason)
+}
+
+// SMPSucceeded implements Metrics
+func (p *PrometheusMetrics) SMPSucceeded() {
+	p.add("smp_successes_total", 1)
+}
+
+// SMPFailed implements Metrics
+func (p *PrometheusMetrics) SMPFailed(reason SMPEvent) {
+	p.add("smp_failures_total", 1, "reason", reason.String())
+}
+
+// FragmentsSent implements Metrics
+func (p *PrometheusMetrics) FragmentsSent(fragments int) {
+	p.add("fragments_sent_total", float64(fragments))
+}
+
+// FragmentsReassembled implements Metrics
+func (p *PrometheusMetrics) FragmentsReassembled(fragments int) {
+	p.add("fragments_reassembled_total", float64(fragments))
+}
+
+// HeartbeatSent implements Metrics
+func (p *PrometheusMetrics) HeartbeatSent() {
+	p.add("heartbeats_sent_total", 1)
+}
+
+// MessageRetransmitted implements Metrics
+func (p *PrometheusMetrics) MessageRetransmitted() {
+	p.add("messages_retransmitted_total", 1)
+}
+
+// MessageError implements Metrics
+func (p *PrometheusMetrics) MessageError(code ErrorCode) {
+	p.add("message_errors_total", 1, "code", code.String())
+}
+
+// Value returns the current value of the named metric, with the labels given as alternating names and values
+func (p *PrometheusMetrics) Value(name string, labels ...string) float64 {
+	key := p.key(name, labels)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.counters[key]
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition format, sorted by name,
+// with the HELP and TYPE of every metric before its samples
+func (p *PrometheusMetrics) WritePrometheus(w io.Writer) error {
+	type sample struct {
+		key, family string
+		value       float64
+	}
+
+	p.lock.Lock()
+	samples := make([]sample, 0, len(p.counters))
+	for k, v := range p.counters {
+		samples = append(samples, sample{k, p.families[k], v})
+	}
+	p.lock.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].family != samples[j].family {
+			return samples[i].family < samples[j].family
+		}
+		return samples[i].key < samples[j].key
+	})
+
+	bw := bufio.NewWriter(w)
+	family := ""
+	for _, s := range samples {
+		if s.family != family {
+			family = s.family
+			f := prometheusFamilies[family]
+			name := p.namespace + "_" + family
+			_, _ = bw.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.kind))
+		}
+		_, _ = bw.WriteString(fmt.Sprintf("%s %v\n", s.key, s.value))
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,131 @@
+package otr3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_Metrics_measuresAConversation(t *testing.T) {
+	m := NewPrometheusMetrics("otr")
+
+	alice, bob := fixtureConversationPair()
+	alice.SetMetrics(m)
+	bob.SetMetrics(m)
+
+	exchangeAll(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	assertEquals(t, m.Value("ake_duration_seconds_count", "version", "3"), float64(2))
+
+	toSend, err := alice.StartAuthenticate("", []byte("one secret"))
+	assertNil(t, err)
+	exchangeAll(t, alice, bob, toSend)
+	toSend, err = bob.ProvideAuthenticationSecret([]byte("another secret"))
+	assertNil(t, err)
+	exchangeAll(t, bob, alice, toSend)
+	assertEquals(t, m.Value("smp_successes_total"), float64(0))
+	assertTrue(t, m.Value("smp_failures_total", "reason", "SMPEventFailure") >= 1)
+
+	bob.SetFragmentSize(200)
+	toSend, _ = bob.Send(ValidMessage("a message that needs fragments"))
+	exchangeAll(t, bob, alice, toSend)
+	assertEquals(t, m.Value("fragments_sent_total"), float64(len(toSend)))
+	assertEquals(t, m.Value("fragments_reassembled_total"), float64(len(toSend)))
+}
+
+func Test_Metrics_countsMessageErrorsByErrorCode(t *testing.T) {
+	m := NewPrometheusMetrics("otr")
+	c := &Conversation{}
+	c.SetMetrics(m)
+
+	c.notifyDataMessageError(newOtrConflictError("counter regressed"))
+	c.notifyDataMessageError(errInvalidOTRMessage)
+	c.notifyDataMessageError(errMessageReplayed)
+
+	assertEquals(t, m.Value("message_errors_total", "code", "ErrorCodeMessageUnreadable"), float64(1))
+	assertEquals(t, m.Value("message_errors_total", "code", "ErrorCodeMessageMalformed"), float64(1))
+}
+
+func Test_Metrics_countsAKEFailuresHeartbeatsAndRetransmissions(t *testing.T) {
+	m := NewPrometheusMetrics("otr")
+	c := &Conversation{}
+	c.SetMetrics(m)
+
+	c.messageEventWithError(MessageEventSetupError, errCorruptEncryptedSignature)
+	c.messageEvent(MessageEventLogHeartbeatSent)
+	c.messageEvent(MessageEventMessageResent)
+	c.messageEvent(MessageEventMessageSent)
+
+	assertEquals(t, m.Value("ake_failures_total", "reason", "signature"), float64(1))
+	assertEquals(t, m.Value("heartbeats_sent_total"), float64(1))
+	assertEquals(t, m.Value("messages_retransmitted_total"), float64(1))
+}
+
+func Test_akeFailureReason_usesAFixedSetOfReasons(t *testing.T) {
+	assertEquals(t, akeFailureReason(newOtrError("bad commit MAC in reveal signature message")), "mac")
+	assertEquals(t, akeFailureReason(errWrongProtocolVersion), "version")
+	assertEquals(t, akeFailureReason(context.Canceled), "cancelled")
+	assertEquals(t, akeFailureReason(newOtrError("in signature message: something unexpected")), "other")
+	assertEquals(t, akeFailureReason(nil), "other")
+}
+
+func Test_Metrics_countsAnAKEFailureWithoutAnError(t *testing.T) {
+	m := NewPrometheusMetrics("otr")
+	c := &Conversation{}
+	c.SetMetrics(m)
+
+	c.messageEventWithError(MessageEventSetupError, nil)
+
+	assertEquals(t, m.Value("ake_failures_total", "reason", "other"), float64(1))
+}
+
+func Test_PrometheusMetrics_WritePrometheus_writesTheTextFormat(t *testing.T) {
+	m := NewPrometheusMetrics("otr")
+	m.AKEFinished(3, 1500*time.Millisecond)
+	m.SMPFailed(SMPEventCheated)
+	m.HeartbeatSent()
+
+	var b bytes.Buffer
+	assertNil(t, m.WritePrometheus(&b))
+	assertEquals(t, b.String(), ""+
+		"# HELP otr_ake_duration_seconds Time taken by the AKEs that finished, by protocol version.\n"+
+		"# TYPE otr_ake_duration_seconds summary\n"+
+		"otr_ake_duration_seconds_count{version=\"3\"} 1\n"+
+		"otr_ake_duration_seconds_sum{version=\"3\"} 1.5\n"+
+		"# HELP otr_heartbeats_sent_total Heartbeats sent.\n"+
+		"# TYPE otr_heartbeats_sent_total counter\n"+
+		"otr_heartbeats_sent_total 1\n"+
+		"# HELP otr_smp_failures_total SMP runs that ended without success, by the event that ended them.\n"+
+		"# TYPE otr_smp_failures_total counter\n"+
+		"otr_smp_failures_total{reason=\"SMPEventCheated\"} 1\n")
+}
+
+type updatingWriter struct {
+	m *PrometheusMetrics
+}
+
+func (w updatingWriter) Write(p []byte) (int, error) {
+	w.m.HeartbeatSent()
+	return len(p), nil
+}
+
+func Test_PrometheusMetrics_WritePrometheus_doesntHoldTheLockWhileWriting(t *testing.T) {
+	m := NewPrometheusMetrics("otr")
+	for i := 0; i < 200; i++ {
+		m.AKEFailed(fmt.Sprintf("a reason long enough to fill the write buffer %d", i))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.WritePrometheus(updatingWriter{m})
+	}()
+
+	select {
+	case err := <-done:
+		assertNil(t, err)
+		assertTrue(t, m.Value("heartbeats_sent_total") > 0)
+	case <-time.After(5 * time.Second):
+		t.Fatal("WritePrometheus blocked metrics from being updated while writing")
+	}
+}
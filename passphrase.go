@@ -0,0 +1,89 @@
+package otr3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The number of PBKDF2 iterations used when deriving a key from a passphrase for new data
+const passphraseKDFIterations = uint32(100000)
+
+// The largest number of PBKDF2 iterations accepted when opening data, so that corrupt or
+// hostile data can't make us spend an unbounded amount of time deriving the key
+const maxPassphraseKDFIterations = 10 * passphraseKDFIterations
+
+const passphraseSaltLength = 16
+const passphraseKeyLength = 32
+
+var errWrongPassphrase = newOtrError("couldn't decrypt data - wrong passphrase or corrupt data")
+
+func passphraseCipher(passphrase, salt []byte, iterations uint32) (cipher.AEAD, error) {
+	key := pbkdf2.Key(passphrase, salt, int(iterations), passphraseKeyLength, sha256.New)
+	defer wipeBytes(key)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealWithPassphrase encrypts and authenticates the plaintext with a key derived from the passphrase.
+// The header is authenticated but not included in the result - it has to be given again when opening the data.
+func sealWithPassphrase(rand io.Reader, header, passphrase, plain []byte) ([]byte, error) {
+	salt := make([]byte, passphraseSaltLength)
+	if err := randomInto(rand, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := passphraseCipher(passphrase, salt, passphraseKDFIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if err := randomInto(rand, nonce); err != nil {
+		return nil, err
+	}
+
+	out := AppendWord(nil, passphraseKDFIterations)
+	out = AppendData(out, salt)
+	out = AppendData(out, nonce)
+
+	ad := append(makeCopy(header), out...)
+	return AppendData(out, aead.Seal(nil, nonce, plain, ad)), nil
+}
+
+// openWithPassphrase reverses sealWithPassphrase, and returns the plaintext and the data following the sealed data
+func openWithPassphrase(header, passphrase, data []byte) (plain []byte, rest []byte, err error) {
+	current, iterations, ok1 := ExtractWord(data)
+	current, salt, ok2 := ExtractData(current)
+	current, nonce, ok3 := ExtractData(current)
+	ad := append(makeCopy(header), data[:len(data)-len(current)]...)
+	rest, sealed, ok4 := ExtractData(current)
+
+	if !(ok1 && ok2 && ok3 && ok4) || iterations == 0 || iterations > maxPassphraseKDFIterations {
+		return nil, nil, errWrongPassphrase
+	}
+
+	aead, err := passphraseCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, nil, errWrongPassphrase
+	}
+
+	plain, err = aead.Open(nil, nonce, sealed, ad)
+	if err != nil {
+		return nil, nil, errWrongPassphrase
+	}
+
+	return plain, rest, nil
+}
@@ -1,6 +1,14 @@
 package otr3
 
-type policies int
+import "strings"
+
+// Policy decides which versions of OTR are allowed and how eagerly an encrypted session is started.
+// It is a combination of the policy flags below, and can be parsed from and written as a string
+// like "allow-v3,require-encryption".
+type Policy int
+
+// policies is the name the rest of the package knows Policy by
+type policies = Policy
 
 type policy int
 
@@ -13,38 +21,172 @@ const (
 	errorStartAKE
 )
 
-func (p *policies) isOTREnabled() bool {
+const (
+	// PolicyAllowV2 allows version 2 of the OTR protocol
+	PolicyAllowV2 = Policy(allowV2)
+	// PolicyAllowV3 allows version 3 of the OTR protocol
+	PolicyAllowV3 = Policy(allowV3)
+	// PolicyRequireEncryption refuses to send unencrypted messages
+	PolicyRequireEncryption = Policy(requireEncryption)
+	// PolicySendWhitespaceTag advertises OTR support with a whitespace tag on plain text messages
+	PolicySendWhitespaceTag = Policy(sendWhitespaceTag)
+	// PolicyWhitespaceStartAKE starts the AKE when a whitespace tag is received
+	PolicyWhitespaceStartAKE = Policy(whitespaceStartAKE)
+	// PolicyErrorStartAKE starts the AKE when an OTR error message is received
+	PolicyErrorStartAKE = Policy(errorStartAKE)
+)
+
+// These presets are equivalent to the libotr policies with the same names
+const (
+	// PolicyNever never uses OTR
+	PolicyNever = Policy(0)
+	// PolicyManual only starts OTR when asked to
+	PolicyManual = PolicyAllowV2 | PolicyAllowV3
+	// PolicyOpportunistic advertises OTR support and starts OTR when the peer supports it
+	PolicyOpportunistic = PolicyManual | PolicySendWhitespaceTag | PolicyWhitespaceStartAKE | PolicyErrorStartAKE
+	// PolicyAlways refuses to send messages unencrypted
+	PolicyAlways = PolicyManual | PolicyRequireEncryption | PolicyWhitespaceStartAKE | PolicyErrorStartAKE
+)
+
+var policyNames = []struct {
+	name string
+	p    Policy
+}{
+	{"allow-v2", PolicyAllowV2},
+	{"allow-v3", PolicyAllowV3},
+	{"require-encryption", PolicyRequireEncryption},
+	{"send-whitespace-tag", PolicySendWhitespaceTag},
+	{"whitespace-start-ake", PolicyWhitespaceStartAKE},
+	{"error-start-ake", PolicyErrorStartAKE},
+}
+
+var policyPresetNames = []struct {
+	name string
+	p    Policy
+}{
+	{"never", PolicyNever},
+	{"manual", PolicyManual},
+	{"opportunistic", PolicyOpportunistic},
+	{"always", PolicyAlways},
+}
+
+// ParsePolicy parses a comma separated list of policy flags and presets, such as "allow-v3,require-encryption" or "opportunistic"
+func ParsePolicy(s string) (Policy, error) {
+	var result Policy
+
+	for _, part := range strings.Split(s, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if name == "" {
+			continue
+		}
+
+		p, ok := policyForName(name)
+		if !ok {
+			return 0, newOtrErrorf("unknown policy %q", name)
+		}
+		result |= p
+	}
+
+	return result, nil
+}
+
+func policyForName(name string) (Policy, bool) {
+	for _, n := range policyNames {
+		if n.name == name {
+			return n.p, true
+		}
+	}
+	for _, n := range policyPresetNames {
+		if n.name == name {
+			return n.p, true
+		}
+	}
+	return 0, false
+}
+
+// String returns the policy as a comma separated list of policy flags, in a form ParsePolicy understands
+func (p Policy) String() string {
+	if p == PolicyNever {
+		return "never"
+	}
+
+	var names []string
+	for _, n := range policyNames {
+		if p.Has(n.p) {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// MarshalText returns the policy in the same form as String
+func (p Policy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText parses the policy using ParsePolicy
+func (p *Policy) UnmarshalText(text []byte) error {
+	res, err := ParsePolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*p = res
+	return nil
+}
+
+// Has returns true if all of the flags in the other policy are set in this policy
+func (p Policy) Has(o Policy) bool {
+	return p&o == o
+}
+
+// Add sets all of the flags in the other policy
+func (p *Policy) Add(o Policy) {
+	*p |= o
+}
+
+// Remove clears all of the flags in the other policy
+func (p *Policy) Remove(o Policy) {
+	*p &^= o
+}
+
+func (p *Policy) isOTREnabled() bool {
 	return p.has(allowV2) || p.has(allowV3)
 }
 
-func (p *policies) has(c policy) bool {
+func (p *Policy) has(c policy) bool {
 	return int(*p)&int(c) == int(c)
 }
 
-func (p *policies) add(c policy) {
-	*p = policies(int(*p) | int(c))
+func (p *Policy) add(c policy) {
+	*p = Policy(int(*p) | int(c))
 }
 
-func (p *policies) AllowV2() {
+// AllowV2 allows version 2 of the OTR protocol
+func (p *Policy) AllowV2() {
 	p.add(allowV2)
 }
 
-func (p *policies) AllowV3() {
+// AllowV3 allows version 3 of the OTR protocol
+func (p *Policy) AllowV3() {
 	p.add(allowV3)
 }
 
-func (p *policies) RequireEncryption() {
+// RequireEncryption refuses to send unencrypted messages
+func (p *Policy) RequireEncryption() {
 	p.add(requireEncryption)
 }
 
-func (p *policies) SendWhitespaceTag() {
+// SendWhitespaceTag advertises OTR support with a whitespace tag on plain text messages
+func (p *Policy) SendWhitespaceTag() {
 	p.add(sendWhitespaceTag)
 }
 
-func (p *policies) WhitespaceStartAKE() {
+// WhitespaceStartAKE starts the AKE when a whitespace tag is received
+func (p *Policy) WhitespaceStartAKE() {
 	p.add(whitespaceStartAKE)
 }
 
-func (p *policies) ErrorStartAKE() {
+// ErrorStartAKE starts the AKE when an OTR error message is received
+func (p *Policy) ErrorStartAKE() {
 	p.add(errorStartAKE)
 }
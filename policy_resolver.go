@@ -0,0 +1,60 @@
+package otr3
+
+// PolicyResolver decides the policy to use for a conversation with a specific peer, from a specific account.
+// It is consulted every time a message is sent or received, so the policy for a peer can change while the conversation is in use.
+type PolicyResolver interface {
+	// ResolvePolicy returns the policy to use for the peer, account and protocol
+	ResolvePolicy(peer, account, protocol string) Policy
+}
+
+type policyResolverContext struct {
+	resolver                PolicyResolver
+	peer, account, protocol string
+}
+
+// SetPolicyResolver assigns the resolver that decides the policies of this conversation. The peer, account and protocol identify this
+// conversation to the resolver.
+//
+// Changing the policy in the middle of a conversation works like this: turning on RequireEncryption while not encrypted starts the AKE,
+// and plain text messages sent before it has finished are queued until then. Versions of OTR can't be disallowed while a
+// secure conversation is in progress - those changes will take effect when it has ended.
+func (c *Conversation) SetPolicyResolver(resolver PolicyResolver, peer, account, protocol string) {
+	c.policyResolver = policyResolverContext{resolver, peer, account, protocol}
+}
+
+// resolvePolicies asks the policy resolver for the current policy, and returns true if
+// encryption has just become required
+func (c *Conversation) resolvePolicies() bool {
+	r := c.policyResolver
+	if r.resolver == nil {
+		return false
+	}
+
+	p := r.resolver.ResolvePolicy(r.peer, r.account, r.protocol)
+	if c.msgState != plainText {
+		p.Add(c.Policies & (PolicyAllowV2 | PolicyAllowV3))
+	}
+
+	encryptionRequired := p.Has(PolicyRequireEncryption) && !c.Policies.Has(PolicyRequireEncryption)
+	if p != c.Policies {
+		c.logDebug("policy changed", "from", c.Policies.String(), "to", p.String())
+	}
+	c.Policies = p
+	return encryptionRequired
+}
+
+// resolvePoliciesBeforeReceive resolves the policies, and starts the AKE if encryption has just become required -
+// unless the message received will start the AKE by itself
+func (c *Conversation) resolvePoliciesBeforeReceive(m ValidMessage) {
+	if c.resolvePolicies() && c.msgState == plainText && c.Policies.isOTREnabled() && !startsAKE(m) {
+		c.injectMessage(c.QueryMessage())
+	}
+}
+
+func startsAKE(m ValidMessage) bool {
+	switch guessMessageType(m) {
+	case msgGuessQuery, msgGuessDHCommit:
+		return true
+	}
+	return false
+}
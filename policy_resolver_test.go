@@ -0,0 +1,85 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+type fixedPolicyResolver struct {
+	policies map[string]Policy
+	asked    []string
+}
+
+func (r *fixedPolicyResolver) ResolvePolicy(peer, account, protocol string) Policy {
+	r.asked = append(r.asked, peer+"/"+account+"/"+protocol)
+	return r.policies[peer]
+}
+
+func Test_Send_consultsThePolicyResolver(t *testing.T) {
+	r := &fixedPolicyResolver{policies: map[string]Policy{"bob": PolicyNever}}
+	c := &Conversation{Policies: PolicyManual}
+	c.SetPolicyResolver(r, "bob", "alice", "xmpp")
+
+	msgs, err := c.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	assertDeepEquals(t, msgs, []ValidMessage{ValidMessage("hello")})
+	assertEquals(t, c.Policies, PolicyNever)
+	assertDeepEquals(t, r.asked, []string{"bob/alice/xmpp"})
+}
+
+func Test_Send_queuesPlainTextMessagesWhenEncryptionBecomesRequired(t *testing.T) {
+	r := &fixedPolicyResolver{policies: map[string]Policy{"bob": PolicyManual}}
+	c := &Conversation{}
+	c.SetPolicyResolver(r, "bob", "alice", "xmpp")
+
+	msgs, _ := c.Send(ValidMessage("not secret"))
+	assertDeepEquals(t, msgs, []ValidMessage{ValidMessage("not secret")})
+
+	r.policies["bob"] = PolicyAlways
+	msgs, _ = c.Send(ValidMessage("secret"))
+	assertDeepEquals(t, msgs, []ValidMessage{c.QueryMessage()})
+	assertDeepEquals(t, c.resend.pending(), []messageToResend{messageToResend{MessagePlaintext("secret"), nil}})
+}
+
+func Test_Receive_startsTheAKEWhenEncryptionBecomesRequired(t *testing.T) {
+	r := &fixedPolicyResolver{policies: map[string]Policy{"bob": PolicyManual}}
+	c := &Conversation{}
+	c.SetPolicyResolver(r, "bob", "alice", "xmpp")
+
+	_, msgs, _ := c.Receive(ValidMessage("hello"))
+	assertNil(t, msgs)
+
+	r.policies["bob"] = PolicyAlways
+	_, msgs, _ = c.Receive(ValidMessage("hello again"))
+	assertDeepEquals(t, msgs, []ValidMessage{c.QueryMessage()})
+
+	_, msgs, _ = c.Receive(ValidMessage("and again"))
+	assertNil(t, msgs)
+}
+
+func Test_Receive_doesntSendAQueryMessageWhenTheMessageStartsTheAKE(t *testing.T) {
+	r := &fixedPolicyResolver{policies: map[string]Policy{"bob": PolicyAlways}}
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = PolicyManual
+	c.SetPolicyResolver(r, "bob", "alice", "xmpp")
+
+	_, msgs, err := c.Receive(ValidMessage("?OTRv3?"))
+	assertNil(t, err)
+	assertEquals(t, len(msgs), 1)
+	assertEquals(t, guessMessageType(msgs[0]), msgGuessDHCommit)
+}
+
+func Test_resolvePolicies_keepsTheAllowedVersionsDuringAnEncryptedSession(t *testing.T) {
+	r := &fixedPolicyResolver{policies: map[string]Policy{"bob": PolicyNever}}
+	c := newConversation(otrV3{}, rand.Reader)
+	c.msgState = encrypted
+	c.Policies = PolicyManual | PolicyRequireEncryption
+	c.SetPolicyResolver(r, "bob", "alice", "xmpp")
+
+	c.resolvePolicies()
+	assertEquals(t, c.Policies, PolicyManual)
+
+	c.msgState = plainText
+	c.resolvePolicies()
+	assertEquals(t, c.Policies, PolicyNever)
+}
@@ -3,39 +3,110 @@ package otr3
 import "testing"
 
 func Test_policies_requireEncryption_addsRequirementOfEncryption(t *testing.T) {
-	p := policies(0)
+	p := Policy(0)
 	p.RequireEncryption()
 	assertEquals(t, p.has(requireEncryption), true)
 }
 
 func Test_policies_sendWhitespaceTag_addsPolicyForSendingWhitespaceTag(t *testing.T) {
-	p := policies(0)
+	p := Policy(0)
 	p.SendWhitespaceTag()
 	assertEquals(t, p.has(sendWhitespaceTag), true)
 }
 
 func Test_policies_whitespaceStartAKE_addsWhitespaceStartAKEPolicy(t *testing.T) {
-	p := policies(0)
+	p := Policy(0)
 	p.WhitespaceStartAKE()
 	assertEquals(t, p.has(whitespaceStartAKE), true)
 }
 
 func Test_policies_errorStartAKE_addsErrorStartAKEPolicy(t *testing.T) {
-	p := policies(0)
+	p := Policy(0)
 	p.ErrorStartAKE()
 	assertEquals(t, p.has(errorStartAKE), true)
 }
 
 func Test_policies_Allowv2_addsV2Policy(t *testing.T) {
-	p := policies(allowV3)
+	p := Policy(allowV3)
 	p.AllowV2()
 	assertEquals(t, p.has(allowV2), true)
 	assertEquals(t, p.has(allowV3), true)
 }
 
 func Test_policies_Allowv3_addsV3Policy(t *testing.T) {
-	p := policies(allowV2)
+	p := Policy(allowV2)
 	p.AllowV3()
 	assertEquals(t, p.has(allowV3), true)
 	assertEquals(t, p.has(allowV2), true)
 }
+
+func Test_Policy_presetsMatchLibotr(t *testing.T) {
+	assertEquals(t, PolicyManual.Has(PolicyAllowV2|PolicyAllowV3), true)
+	assertEquals(t, PolicyManual.Has(PolicySendWhitespaceTag), false)
+	assertEquals(t, PolicyOpportunistic.Has(PolicySendWhitespaceTag|PolicyWhitespaceStartAKE|PolicyErrorStartAKE), true)
+	assertEquals(t, PolicyOpportunistic.Has(PolicyRequireEncryption), false)
+	assertEquals(t, PolicyAlways.Has(PolicyRequireEncryption), true)
+	assertEquals(t, PolicyAlways.Has(PolicySendWhitespaceTag), false)
+
+	never := PolicyNever
+	assertEquals(t, never.isOTREnabled(), false)
+}
+
+func Test_Policy_Remove_clearsTheFlags(t *testing.T) {
+	p := PolicyAlways
+	p.Remove(PolicyRequireEncryption | PolicyAllowV2)
+	assertEquals(t, p.Has(PolicyRequireEncryption), false)
+	assertEquals(t, p.Has(PolicyAllowV2), false)
+	assertEquals(t, p.Has(PolicyAllowV3), true)
+}
+
+func Test_Policy_Add_setsTheFlags(t *testing.T) {
+	p := PolicyNever
+	p.Add(PolicyAllowV3 | PolicyRequireEncryption)
+	assertEquals(t, p, PolicyAllowV3|PolicyRequireEncryption)
+}
+
+func Test_Policy_String_listsTheFlags(t *testing.T) {
+	assertEquals(t, (PolicyAllowV3 | PolicyRequireEncryption).String(), "allow-v3,require-encryption")
+	assertEquals(t, PolicyNever.String(), "never")
+	assertEquals(t, PolicyOpportunistic.String(), "allow-v2,allow-v3,send-whitespace-tag,whitespace-start-ake,error-start-ake")
+}
+
+func Test_ParsePolicy_parsesFlagsAndPresets(t *testing.T) {
+	p, err := ParsePolicy("allow-v3, Require-Encryption")
+	assertNil(t, err)
+	assertEquals(t, p, PolicyAllowV3|PolicyRequireEncryption)
+
+	p, err = ParsePolicy("manual,send-whitespace-tag")
+	assertNil(t, err)
+	assertEquals(t, p, PolicyManual|PolicySendWhitespaceTag)
+
+	p, err = ParsePolicy("never")
+	assertNil(t, err)
+	assertEquals(t, p, PolicyNever)
+}
+
+func Test_ParsePolicy_roundTripsWithString(t *testing.T) {
+	for _, p := range []Policy{PolicyNever, PolicyManual, PolicyOpportunistic, PolicyAlways, PolicyAllowV2 | PolicyErrorStartAKE} {
+		res, err := ParsePolicy(p.String())
+		assertNil(t, err)
+		assertEquals(t, res, p)
+	}
+}
+
+func Test_ParsePolicy_failsOnUnknownNames(t *testing.T) {
+	_, err := ParsePolicy("allow-v3,allow-v4")
+	assertDeepEquals(t, err, newOtrErrorf("unknown policy %q", "allow-v4"))
+}
+
+func Test_Policy_UnmarshalText_parsesThePolicy(t *testing.T) {
+	var p Policy
+	assertNil(t, p.UnmarshalText([]byte("always")))
+	assertEquals(t, p, PolicyAlways)
+
+	text, err := p.MarshalText()
+	assertNil(t, err)
+	assertEquals(t, string(text), "allow-v2,allow-v3,require-encryption,whitespace-start-ake,error-start-ake")
+
+	assertNotNil(t, p.UnmarshalText([]byte("sometimes")))
+}
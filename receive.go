@@ -1,12 +1,15 @@
 package otr3
 
+import "time"
+
 // Receive handles a message from a peer. It returns a human readable message and zero or more messages to send back to the peer.
 func (c *Conversation) Receive(m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
-	return c.receiveUnit(m, true)
+	c.resolvePoliciesBeforeReceive(m)
+	return c.receiveUnit(m)
 }
 
 // Receive handles a message from a peer. It returns a human readable message and zero or more messages to send back to the peer.
-func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+func (c *Conversation) receiveUnit(m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
 	message := makeCopy(m)
 	defer wipeBytes(message)
 
@@ -16,7 +19,6 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 
 	msgType := guessMessageType(message)
 	var messagesToSend []messageWithHeader
-	shouldForgetFragment := true
 	switch msgType {
 	case msgGuessError:
 		return c.withInjectionsPlain(c.receiveErrorMessage(message))
@@ -29,10 +31,10 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 	case msgGuessV1KeyExch:
 		return nil, nil, errUnsupportedOTRVersion
 	case msgGuessFragment:
-		shouldForgetFragment = false
-		c.fragmentationContext, err = c.receiveFragment(c.fragmentationContext, message)
-		if fragmentsFinished(c.fragmentationContext) {
-			return c.withInjectionsPlain(c.receiveUnit(c.fragmentationContext.frag, false))
+		var complete []byte
+		complete, err = c.reassembleFragment(message, time.Now())
+		if complete != nil {
+			return c.withInjectionsPlain(c.receiveUnit(complete))
 		}
 	case msgGuessUnknown:
 		c.messageEvent(MessageEventReceivedMessageUnrecognized)
@@ -40,10 +42,6 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 		plain, messagesToSend, err = c.receiveEncoded(encodedMessage(message))
 	}
 
-	if shouldForgetFragment && forgetFragments {
-		c.fragmentationContext = forgetFragment()
-	}
-
 	return c.withInjectionsPlain(c.toSendEncoded(plain, messagesToSend, err))
 }
 
@@ -62,6 +60,7 @@ func (c *Conversation) receiveErrorMessage(message ValidMessage) (plain MessageP
 	msg := MessagePlaintext(makeCopy(message[len(errorMarker):]))
 
 	if c.Policies.has(errorStartAKE) {
+		c.logDebug("starting AKE from error message")
 		toSend = []ValidMessage{c.QueryMessage()}
 	}
 
@@ -105,6 +104,7 @@ func (c *Conversation) checkPlaintextPolicies(plain MessagePlaintext) {
 	}
 
 	if c.msgState != plainText || c.Policies.has(requireEncryption) {
+		c.logWarn("unencrypted message received", "msg_state", c.msgState.identityString())
 		c.messageEventWithMessage(MessageEventReceivedMessageUnencrypted, plain)
 	}
 }
@@ -180,6 +180,12 @@ func (c *Conversation) notifyDataMessageError(err error) {
 		return
 	}
 
+	// Replays are usually duplicates from the network, so we don't bother the peer with an error message
+	if err == errMessageReplayed {
+		c.messageEvent(MessageEventReceivedMessageReplayed)
+		return
+	}
+
 	if isConflict(err) {
 		c.messageEvent(MessageEventReceivedMessageUnreadable)
 		e = ErrorCodeMessageUnreadable
@@ -3,6 +3,7 @@ package otr3
 import (
 	"crypto/rand"
 	"testing"
+	"time"
 )
 
 func Test_receiveDecoded_resolveProtocolVersion(t *testing.T) {
@@ -234,12 +235,11 @@ func Test_Receive_returnsAnErrorIfWeReceiveARequestToStartAVersion1KeyExchange(t
 	assertEquals(t, err, errUnsupportedOTRVersion)
 }
 
-func Test_Receive_willResetFragmentationContextIfWeReceiveAnUnfragmentedMessage(t *testing.T) {
+func Test_Receive_keepsPartialMessagesIfWeReceiveAnUnfragmentedMessage(t *testing.T) {
 	c := aliceContextAfterAKE()
-	c.fragmentationContext = fragmentationContext{[]byte("hello"), 2, 5}
+	partial := &partialMessage{fragmentKey{0, 5}, fragmentationContext{[]byte("hello"), 2, 5}, time.Now()}
+	c.fragments.partial = []*partialMessage{partial}
 	_, _, _ = c.Receive(ValidMessage("Hello World"))
 
-	assertNil(t, c.fragmentationContext.frag)
-	assertEquals(t, c.fragmentationContext.currentIndex, uint16(0))
-	assertEquals(t, c.fragmentationContext.currentLen, uint16(0))
+	assertDeepEquals(t, c.fragments.partial, []*partialMessage{partial})
 }
@@ -0,0 +1,212 @@
+package otr3
+
+import "bytes"
+
+// The number of received data messages remembered in order to detect replays
+const replayCacheSize = 256
+
+var errMessageReplayed = newOtrConflictError("message replayed")
+
+type windowKeys struct {
+	ourKeyID, theirKeyID uint32
+	receivingAESKey      []byte
+	receivingMACKey      macKey
+	extraKey             []byte
+	// revealPending is set when the MAC key would have been revealed if it wasn't kept in the window
+	revealPending bool
+}
+
+// receiveWindow keeps the receiving keys of the most recently used key pairs, so that messages arriving late
+// can still be read after the keys they were sent with have been rotated away. The MAC keys of the key pairs
+// in the window are not revealed until they leave the window, since anyone could forge messages with them after that.
+type receiveWindow struct {
+	size    int
+	entries []*windowKeys
+}
+
+// SetReceiveWindow decides how many of the most recently used key pairs are kept around to read messages
+// that arrive after the keys they were sent with have been rotated. Revealing the MAC keys of those key pairs will be
+// delayed until they leave the window. The default size of zero only accepts messages for the current and previous keys, in order.
+func (c *Conversation) SetReceiveWindow(size int) {
+	c.receiveWindowSize = size
+	c.keys.receiveWindow.size = size
+}
+
+func (w *receiveWindow) find(ourKeyID, theirKeyID uint32) *windowKeys {
+	for _, e := range w.entries {
+		if e.ourKeyID == ourKeyID && e.theirKeyID == theirKeyID {
+			return e
+		}
+	}
+	return nil
+}
+
+// remember adds the receiving keys to the window, and returns the MAC keys of the entries that left the window and should be revealed now
+func (w *receiveWindow) remember(ourKeyID, theirKeyID uint32, keys sessionKeys) []macKey {
+	if w.size <= 0 || w.find(ourKeyID, theirKeyID) != nil {
+		return nil
+	}
+
+	w.entries = append(w.entries, &windowKeys{
+		ourKeyID:        ourKeyID,
+		theirKeyID:      theirKeyID,
+		receivingAESKey: makeCopy(keys.receivingAESKey),
+		receivingMACKey: makeCopy(keys.receivingMACKey),
+		extraKey:        makeCopy(keys.extraKey),
+	})
+
+	var toReveal []macKey
+	for len(w.entries) > w.size {
+		e := w.entries[0]
+		w.entries = w.entries[1:]
+		if e.revealPending {
+			toReveal = append(toReveal, e.receivingMACKey)
+		}
+		wipeBytes(e.receivingAESKey)
+		wipeBytes(e.extraKey)
+	}
+	return toReveal
+}
+
+// lookupOr returns the keys kept for the given key pair, or the error if there are none
+func (w *receiveWindow) lookupOr(ourKeyID, theirKeyID uint32, err error) (sessionKeys, error) {
+	e := w.find(ourKeyID, theirKeyID)
+	if e == nil {
+		return sessionKeys{}, err
+	}
+
+	return sessionKeys{
+		receivingAESKey: makeCopy(e.receivingAESKey),
+		receivingMACKey: makeCopy(e.receivingMACKey),
+		extraKey:        makeCopy(e.extraKey),
+	}, nil
+}
+
+// holdBack returns the MAC keys that can be revealed now, marking the others to be revealed when they leave the window
+func (w *receiveWindow) holdBack(keys []macKey) []macKey {
+	var ret []macKey
+	for _, k := range keys {
+		held := false
+		for _, e := range w.entries {
+			if bytes.Equal(e.receivingMACKey, k) {
+				e.revealPending = true
+				held = true
+			}
+		}
+		if !held {
+			ret = append(ret, k)
+		}
+	}
+	return ret
+}
+
+// heldBack returns the MAC keys that would have been revealed if they weren't kept in the window
+func (w *receiveWindow) heldBack() []macKey {
+	var ret []macKey
+	for _, e := range w.entries {
+		if e.revealPending {
+			ret = append(ret, makeCopy(e.receivingMACKey))
+		}
+	}
+	return ret
+}
+
+func (w *receiveWindow) wipe() {
+	for _, e := range w.entries {
+		wipeBytes(e.receivingAESKey)
+		wipeBytes(e.receivingMACKey)
+		wipeBytes(e.extraKey)
+	}
+	w.entries = nil
+}
+
+type keyIDPair struct {
+	ourKeyID, theirKeyID uint32
+}
+
+type receivedCounter struct {
+	keyIDPair
+	counter uint64
+}
+
+// replayCache remembers the counters of the most recently received data messages. For every key pair
+// it also keeps the highest counter it has forgotten, since replays of those can no longer be detected.
+type replayCache struct {
+	seen      []receivedCounter
+	forgotten map[keyIDPair]uint64
+}
+
+func (r *replayCache) contains(ourKeyID, theirKeyID uint32, counter uint64) bool {
+	for _, s := range r.seen {
+		if s == (receivedCounter{keyIDPair{ourKeyID, theirKeyID}, counter}) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *replayCache) add(ourKeyID, theirKeyID uint32, counter uint64) {
+	r.seen = append(r.seen, receivedCounter{keyIDPair{ourKeyID, theirKeyID}, counter})
+	if len(r.seen) <= replayCacheSize {
+		return
+	}
+
+	f := r.seen[0]
+	r.seen = r.seen[1:]
+	r.forgetUpTo(f.keyIDPair, f.counter)
+}
+
+// forgetUpTo makes the cache treat all counters up to the given one as forgotten, so that none of them are accepted late
+func (r *replayCache) forgetUpTo(p keyIDPair, counter uint64) {
+	if r.forgotten == nil {
+		r.forgotten = make(map[keyIDPair]uint64)
+	}
+	if counter > r.forgotten[p] {
+		r.forgotten[p] = counter
+	}
+}
+
+// keepOnly forgets everything about the key pairs that keep returns false for. Once a key pair can't be used
+// to receive messages anymore, none of its messages can be replayed, so there is nothing left to remember about it.
+func (r *replayCache) keepOnly(keep func(keyIDPair) bool) {
+	seen := r.seen[:0]
+	for _, s := range r.seen {
+		if keep(s.keyIDPair) {
+			seen = append(seen, s)
+		}
+	}
+	r.seen = seen
+
+	for p := range r.forgotten {
+		if !keep(p) {
+			delete(r.forgotten, p)
+		}
+	}
+}
+
+func (r *replayCache) wipe() {
+	r.seen = nil
+	r.forgotten = nil
+}
+
+// acceptsLateCounter returns true if a message with a counter lower than the highest one received can still be accepted.
+// This is only possible with a receive window, and only as long as the replay cache still knows which counters have been seen.
+func (k *keyManagementContext) acceptsLateCounter(ourKeyID, theirKeyID uint32, counter uint64) bool {
+	return k.receiveWindow.size > 0 && counter > k.replays.forgotten[keyIDPair{ourKeyID, theirKeyID}]
+}
+
+// canReceiveWith returns true if messages sent with the given key pair can still be read
+func (k *keyManagementContext) canReceiveWith(p keyIDPair) bool {
+	if k.receiveWindow.find(p.ourKeyID, p.theirKeyID) != nil {
+		return true
+	}
+	_, _, errOur := k.pickOurKeys(p.ourKeyID)
+	_, errTheir := k.pickTheirKey(p.theirKeyID)
+	return errOur == nil && errTheir == nil
+}
+
+// forgetUnusableKeyPairs removes the replay information about key pairs that have been rotated out
+// of both the current keys and the receive window, since key ids never come back
+func (k *keyManagementContext) forgetUnusableKeyPairs() {
+	k.replays.keepOnly(k.canReceiveWith)
+}
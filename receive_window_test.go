@@ -0,0 +1,118 @@
+package otr3
+
+import "testing"
+
+func Test_receive_acceptsMessagesOutOfOrderWithAReceiveWindow(t *testing.T) {
+	alice, bob := fixtureEncryptedConversationsWithReceiveWindow(4)
+	first := sendOne(t, alice, "first")
+	second := sendOne(t, alice, "second")
+
+	plain, _, err := bob.Receive(second)
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("second"))
+
+	plain, _, err = bob.Receive(first)
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("first"))
+}
+
+func Test_receive_rejectsMessagesOutOfOrderWithoutAReceiveWindow(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	first := sendOne(t, alice, "first")
+	_, _, _ = bob.Receive(sendOne(t, alice, "second"))
+
+	bob.expectMessageEvent(t, func() {
+		_, _, _ = bob.Receive(first)
+	}, MessageEventReceivedMessageUnreadable, nil, nil)
+}
+
+func Test_receive_readsAMessageSentWithKeysThatHaveBeenRotatedAwayWithAReceiveWindow(t *testing.T) {
+	alice, bob := fixtureEncryptedConversationsWithReceiveWindow(8)
+	exchangeMessages(t, alice, bob, 1)
+
+	late := sendOne(t, alice, "late")
+	_, _, err := bob.Receive(sendOne(t, alice, "on time"))
+	assertNil(t, err)
+	exchangeMessages(t, alice, bob, 2)
+
+	plain, _, err := bob.Receive(late)
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("late"))
+}
+
+func Test_receive_cannotReadAMessageSentWithKeysThatHaveBeenRotatedAwayWithoutAReceiveWindow(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	exchangeMessages(t, alice, bob, 1)
+
+	late := sendOne(t, alice, "late")
+	_, _, err := bob.Receive(sendOne(t, alice, "on time"))
+	assertNil(t, err)
+	exchangeMessages(t, alice, bob, 2)
+
+	plain, _, err := bob.Receive(late)
+	assertNotNil(t, err)
+	assertNil(t, plain)
+}
+
+func Test_receiveWindow_holdsBackMACKeysUntilTheyLeaveTheWindow(t *testing.T) {
+	w := receiveWindow{size: 1}
+	first := sessionKeys{receivingMACKey: macKey{0x01}}
+	second := sessionKeys{receivingMACKey: macKey{0x02}}
+
+	assertNil(t, w.remember(1, 1, first))
+	assertDeepEquals(t, w.holdBack([]macKey{first.receivingMACKey, macKey{0x03}}), []macKey{macKey{0x03}})
+	assertDeepEquals(t, w.heldBack(), []macKey{first.receivingMACKey})
+
+	assertDeepEquals(t, w.remember(1, 2, second), []macKey{first.receivingMACKey})
+	assertNil(t, w.heldBack())
+}
+
+func Test_receiveWindow_lookupOr_returnsTheErrorForUnknownKeys(t *testing.T) {
+	w := receiveWindow{size: 1}
+	w.remember(1, 1, sessionKeys{receivingAESKey: []byte{0x01}})
+
+	keys, err := w.lookupOr(1, 1, errMessageReplayed)
+	assertNil(t, err)
+	assertDeepEquals(t, keys.receivingAESKey, []byte{0x01})
+
+	_, err = w.lookupOr(2, 1, errMessageReplayed)
+	assertEquals(t, err, errMessageReplayed)
+}
+
+func Test_replayCache_remembersTheHighestForgottenCounter(t *testing.T) {
+	r := replayCache{}
+	for i := uint64(1); i <= replayCacheSize+2; i++ {
+		r.add(1, 1, i)
+	}
+
+	assertFalse(t, r.contains(1, 1, 1))
+	assertTrue(t, r.contains(1, 1, 3))
+	assertEquals(t, r.forgotten[keyIDPair{1, 1}], uint64(2))
+}
+
+func Test_replayCache_forgetsKeyPairsThatHaveBeenRotatedAway(t *testing.T) {
+	alice, bob := fixtureEncryptedConversationsWithReceiveWindow(2)
+	exchangeMessages(t, alice, bob, replayCacheSize+50)
+
+	assertTrue(t, len(bob.keys.replays.seen) <= replayCacheSize)
+	for p := range bob.keys.replays.forgotten {
+		assertTrue(t, bob.keys.canReceiveWith(p))
+	}
+	for _, s := range bob.keys.replays.seen {
+		assertTrue(t, bob.keys.canReceiveWith(s.keyIDPair))
+	}
+}
+
+func Test_replayCache_keepOnly_forgetsTheOtherKeyPairs(t *testing.T) {
+	r := replayCache{}
+	r.add(1, 1, 1)
+	r.add(2, 1, 1)
+	r.forgetUpTo(keyIDPair{1, 1}, 1)
+	r.forgetUpTo(keyIDPair{2, 1}, 1)
+
+	r.keepOnly(func(p keyIDPair) bool { return p.ourKeyID == 2 })
+
+	assertFalse(t, r.contains(1, 1, 1))
+	assertTrue(t, r.contains(2, 1, 1))
+	assertDeepEquals(t, r.forgotten, map[keyIDPair]uint64{keyIDPair{2, 1}: 1})
+}
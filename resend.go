@@ -5,6 +5,7 @@ import (
 	"time"
 )
 
+// How long are queued messages kept waiting for the encrypted session by default?
 const resendInterval = 60 * time.Second
 
 type retransmitFlag int
@@ -27,24 +28,163 @@ type resendContext struct {
 	messageTransform func([]byte) []byte
 	retransmitting   bool
 
+	store     ResendStore
+	expiry    time.Duration
+	maxQueued int
+
 	messages struct {
-		m []messageToResend
+		m []QueuedMessage
 		sync.RWMutex
 	}
 }
 
-func (r *resendContext) later(msg MessagePlaintext, opaque ...interface{}) {
-	if r.retransmitting {
+// SetResendStore assigns the store that keeps the messages waiting to be sent until the encrypted session is established.
+// Messages already in the store are queued for this conversation, and will be sent once the encrypted session is established.
+func (c *Conversation) SetResendStore(store ResendStore) {
+	r := &c.resend
+	r.messages.Lock()
+	defer r.messages.Unlock()
+
+	r.store = store
+	inMemory := r.messages.m
+	stored := store.Messages()
+	r.messages.m = append(stored, inMemory...)
+	if len(unsentIn(stored)) > 0 && r.mayRetransmit == noRetransmit {
+		r.mayRetransmit = retransmitExact
+	}
+	if len(unsentIn(inMemory)) > 0 {
+		r.save()
+	}
+}
+
+// SetResendLimits decides for how long queued messages will be kept waiting for the encrypted session, and how many
+// messages can be waiting to be sent. When too many messages are waiting the oldest will be dropped. Messages that have
+// already been sent, and are only kept in case they have to be sent again, don't count against the limit. Zero values
+// mean the default expiry of 60 seconds, and no limit on the number of messages.
+func (c *Conversation) SetResendLimits(expiry time.Duration, maxQueued int) {
+	c.resend.expiry = expiry
+	c.resend.maxQueued = maxQueued
+}
+
+func (r *resendContext) expiryOrDefault() time.Duration {
+	if r.expiry > 0 {
+		return r.expiry
+	}
+	return resendInterval
+}
+
+func (r *resendContext) expiryFrom(now time.Time) time.Time {
+	return now.Add(r.expiryOrDefault())
+}
+
+func unsentIn(msgs []QueuedMessage) []QueuedMessage {
+	var unsent []QueuedMessage
+	for _, m := range msgs {
+		if !m.Sent {
+			unsent = append(unsent, m)
+		}
+	}
+	return unsent
+}
+
+// save writes the messages that haven't been sent yet to the store. It should only be called when those have changed.
+// The queue in memory is used even if saving fails, so the worst that can happen is that the messages don't survive a restart
+func (r *resendContext) save() {
+	if r.store == nil {
 		return
 	}
 
+	_ = r.store.SetMessages(unsentIn(r.messages.m))
+}
+
+// later queues the message, and returns the messages dropped to make room for it
+func (r *resendContext) later(msg MessagePlaintext, opaque ...interface{}) []QueuedMessage {
+	return r.queue(msg, false, opaque...)
+}
+
+func (r *resendContext) queue(msg MessagePlaintext, sent bool, opaque ...interface{}) []QueuedMessage {
+	if r.retransmitting {
+		return nil
+	}
+
 	r.messages.Lock()
 	defer r.messages.Unlock()
 
 	if r.messages.m == nil {
-		r.messages.m = make([]messageToResend, 0, 5)
+		r.messages.m = make([]QueuedMessage, 0, 5)
+	}
+
+	now := time.Now()
+	r.messages.m = append(r.messages.m, QueuedMessage{
+		Message: makeCopy(msg),
+		Queued:  now,
+		Expires: r.expiryFrom(now),
+		Sent:    sent,
+		Opaque:  opaque,
+	})
+
+	// Messages that have been sent are only kept in case they have to be sent again, so they don't need saving
+	if sent {
+		return nil
+	}
+
+	dropped := r.dropOldestUnsent()
+	r.save()
+	return dropped
+}
+
+// dropOldestUnsent drops the oldest messages waiting to be sent while there are more of them than allowed, and returns them
+func (r *resendContext) dropOldestUnsent() []QueuedMessage {
+	if r.maxQueued <= 0 {
+		return nil
+	}
+
+	var dropped []QueuedMessage
+	toDrop := len(unsentIn(r.messages.m)) - r.maxQueued
+	kept := r.messages.m[:0]
+	for _, m := range r.messages.m {
+		if !m.Sent && len(dropped) < toDrop {
+			dropped = append(dropped, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	r.messages.m = kept
+	return dropped
+}
+
+// expire removes the messages that have expired at the given time and returns them
+func (r *resendContext) expire(now time.Time) []QueuedMessage {
+	r.messages.Lock()
+	defer r.messages.Unlock()
+
+	var expired []QueuedMessage
+	kept := r.messages.m[:0]
+	for _, m := range r.messages.m {
+		if m.Expires.After(now) {
+			kept = append(kept, m)
+		} else {
+			expired = append(expired, m)
+		}
 	}
-	r.messages.m = append(r.messages.m, messageToResend{makeCopy(msg), opaque})
+
+	r.messages.m = kept
+	if len(unsentIn(expired)) > 0 {
+		r.save()
+	}
+	return expired
+}
+
+func (r *resendContext) hasUnexpired(now time.Time) bool {
+	r.messages.RLock()
+	defer r.messages.RUnlock()
+
+	for _, m := range r.messages.m {
+		if m.Expires.After(now) {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *resendContext) pending() []messageToResend {
@@ -52,7 +192,9 @@ func (r *resendContext) pending() []messageToResend {
 	defer r.messages.RUnlock()
 
 	ret := make([]messageToResend, len(r.messages.m))
-	copy(ret, r.messages.m)
+	for i, m := range r.messages.m {
+		ret[i] = messageToResend{m.Message, m.Opaque}
+	}
 
 	return ret
 }
@@ -61,11 +203,15 @@ func (r *resendContext) clear() {
 	r.messages.Lock()
 	defer r.messages.Unlock()
 
+	hadUnsent := len(unsentIn(r.messages.m)) > 0
 	r.messages.m = nil
+	if hadUnsent {
+		r.save()
+	}
 }
 
 func (r *resendContext) shouldRetransmit() bool {
-	return len(r.messages.m) > 0 && r.mayRetransmit != noRetransmit
+	return r.hasUnexpired(time.Now()) && r.mayRetransmit != noRetransmit
 }
 
 func (r *resendContext) startRetransmitting() {
@@ -88,19 +234,39 @@ func (c *Conversation) resendMessageTransformer() func([]byte) []byte {
 }
 
 func (c *Conversation) lastMessage(msg MessagePlaintext, opaque ...interface{}) {
-	c.resend.later(msg, opaque...)
+	c.signalExpired(c.resend.later(msg, opaque...))
+}
+
+// lastSentMessage remembers a message that has already been sent, in case the peer can't read it and we need to send it again
+func (c *Conversation) lastSentMessage(msg MessagePlaintext, opaque ...interface{}) {
+	c.signalExpired(c.resend.queue(msg, true, opaque...))
+}
+
+// signalExpired lets the user know about the messages that will never be delivered
+func (c *Conversation) signalExpired(msgs []QueuedMessage) {
+	for _, m := range msgs {
+		if !m.Sent {
+			c.messageEvent(MessageEventMessageExpired, m.Opaque...)
+		}
+	}
+}
+
+func (c *Conversation) expireQueuedMessages(now time.Time) {
+	c.signalExpired(c.resend.expire(now))
 }
 
 func (c *Conversation) updateMayRetransmitTo(f retransmitFlag) {
 	c.resend.mayRetransmit = f
 }
 
+// shouldRetransmit decides from the expiry of the queued messages, since messages loaded from a resend store
+// after a restart might never have been sent by this conversation
 func (c *Conversation) shouldRetransmit() bool {
-	return c.resend.shouldRetransmit() &&
-		c.heartbeat.lastSent.After(time.Now().Add(-resendInterval))
+	return c.resend.shouldRetransmit()
 }
 
 func (c *Conversation) maybeRetransmit() ([]messageWithHeader, error) {
+	c.expireQueuedMessages(time.Now())
 	if !c.shouldRetransmit() {
 		return nil, nil
 	}
@@ -0,0 +1,139 @@
+package otr3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueuedMessage is a message from the local user waiting to be sent when the encrypted session has been established
+type QueuedMessage struct {
+	Message MessagePlaintext
+	Queued  time.Time
+	Expires time.Time
+	// Sent is true for messages that have already been sent, and are only kept in case the peer couldn't read them
+	Sent bool
+	// Opaque is the trace given when the message was sent. It is not written to files
+	Opaque []interface{}
+}
+
+// ResendStore keeps the messages waiting to be sent until the encrypted session has been established,
+// so that they are not lost if the application is restarted before that
+type ResendStore interface {
+	// Messages returns all messages in the store, oldest first
+	Messages() []QueuedMessage
+	// SetMessages replaces all messages in the store
+	SetMessages(msgs []QueuedMessage) error
+}
+
+// ImportQueuedMessages will read the queued messages given and return them
+func ImportQueuedMessages(r io.Reader) ([]QueuedMessage, error) {
+	var result []QueuedMessage
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r\n")
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "\t")
+		if len(parts) != 3 {
+			return nil, newOtrError("couldn't import queued messages - invalid line")
+		}
+
+		queued, err1 := strconv.ParseInt(parts[0], 10, 64)
+		expires, err2 := strconv.ParseInt(parts[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, newOtrError("couldn't import queued messages - invalid time")
+		}
+
+		msg, err := b64decode([]byte(parts[2]))
+		if err != nil {
+			return nil, newOtrError("couldn't import queued messages - invalid message")
+		}
+
+		result = append(result, QueuedMessage{
+			Message: MessagePlaintext(msg),
+			Queued:  time.Unix(0, queued),
+			Expires: time.Unix(0, expires),
+		})
+	}
+
+	return result, s.Err()
+}
+
+// ExportQueuedMessages will write all the given messages, one per line
+func ExportQueuedMessages(msgs []QueuedMessage, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range msgs {
+		_, _ = bw.WriteString(fmt.Sprintf("%d\t%d\t%s\n", m.Queued.UnixNano(), m.Expires.UnixNano(), b64encode(m.Message)))
+	}
+	return bw.Flush()
+}
+
+// ImportQueuedMessagesFromFile will read the queued messages file given and return the messages in it
+func ImportQueuedMessagesFromFile(fname string) ([]QueuedMessage, error) {
+	f, err := os.Open(filepath.Clean(fname))
+	if err != nil {
+		return nil, err
+	}
+
+	res, e := ImportQueuedMessages(f)
+	if e != nil {
+		_ = f.Close()
+		return nil, e
+	}
+
+	return res, f.Close()
+}
+
+// ExportQueuedMessagesToFile will create the named file (or truncate it) and write all the messages to it
+func ExportQueuedMessagesToFile(msgs []QueuedMessage, fname string) error {
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := ExportQueuedMessages(msgs, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// FileResendStore is a ResendStore backed by a file. Every change to the queue is written to the file immediately.
+// Since the file contains the plain text of the messages, it should be kept somewhere safe.
+type FileResendStore struct {
+	fname string
+	msgs  []QueuedMessage
+}
+
+// NewFileResendStore creates a ResendStore that reads and writes the given file. It is not an error for the file to not exist yet.
+func NewFileResendStore(fname string) (*FileResendStore, error) {
+	msgs, err := ImportQueuedMessagesFromFile(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &FileResendStore{fname: fname, msgs: msgs}, nil
+}
+
+// Messages returns all messages in the store, oldest first
+func (s *FileResendStore) Messages() []QueuedMessage {
+	ret := make([]QueuedMessage, len(s.msgs))
+	copy(ret, s.msgs)
+	return ret
+}
+
+// SetMessages replaces all messages in the store and writes the file
+func (s *FileResendStore) SetMessages(msgs []QueuedMessage) error {
+	s.msgs = make([]QueuedMessage, len(msgs))
+	copy(s.msgs, msgs)
+	return ExportQueuedMessagesToFile(s.msgs, s.fname)
+}
@@ -0,0 +1,123 @@
+package otr3
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_ExportQueuedMessages_canBeImportedAgain(t *testing.T) {
+	queued := time.Unix(1000, 42)
+	msgs := []QueuedMessage{
+		QueuedMessage{Message: MessagePlaintext("hello\tthere\n"), Queued: queued, Expires: queued.Add(time.Minute)},
+		QueuedMessage{Message: MessagePlaintext("again"), Queued: queued, Expires: queued.Add(time.Hour)},
+	}
+
+	var b bytes.Buffer
+	assertNil(t, ExportQueuedMessages(msgs, &b))
+
+	res, err := ImportQueuedMessages(&b)
+	assertNil(t, err)
+	assertEquals(t, len(res), 2)
+	assertDeepEquals(t, res[0].Message, MessagePlaintext("hello\tthere\n"))
+	assertTrue(t, res[0].Queued.Equal(queued))
+	assertTrue(t, res[1].Expires.Equal(queued.Add(time.Hour)))
+}
+
+func Test_ImportQueuedMessages_failsOnInvalidLines(t *testing.T) {
+	_, err := ImportQueuedMessages(bytes.NewBufferString("1\t2\n"))
+	assertDeepEquals(t, err, newOtrError("couldn't import queued messages - invalid line"))
+
+	_, err = ImportQueuedMessages(bytes.NewBufferString("a\t2\taGVsbG8=\n"))
+	assertDeepEquals(t, err, newOtrError("couldn't import queued messages - invalid time"))
+
+	_, err = ImportQueuedMessages(bytes.NewBufferString("1\t2\t!!!\n"))
+	assertDeepEquals(t, err, newOtrError("couldn't import queued messages - invalid message"))
+}
+
+func Test_NewFileResendStore_acceptsAMissingFile(t *testing.T) {
+	s, err := NewFileResendStore("test_resources/this_file_does_not_exist")
+	assertNil(t, err)
+	assertEquals(t, len(s.Messages()), 0)
+}
+
+func Test_Conversation_keepsUnsentMessagesInTheResendStore(t *testing.T) {
+	fname := "test_resources/test_queued_messages.blah"
+	defer os.Remove(fname)
+
+	s, err := NewFileResendStore(fname)
+	assertNil(t, err)
+
+	c := &Conversation{}
+	c.SetResendStore(s)
+	c.lastMessage(MessagePlaintext("waiting for encryption"))
+	c.lastSentMessage(MessagePlaintext("already sent"))
+
+	s2, err := NewFileResendStore(fname)
+	assertNil(t, err)
+
+	c2 := &Conversation{}
+	c2.SetResendStore(s2)
+	assertDeepEquals(t, c2.resend.pending(), []messageToResend{
+		messageToResend{MessagePlaintext("waiting for encryption"), nil},
+	})
+
+	c2.resend.clear()
+	s3, _ := NewFileResendStore(fname)
+	assertEquals(t, len(s3.Messages()), 0)
+}
+
+type countingResendStore struct {
+	msgs  []QueuedMessage
+	saves int
+}
+
+func (s *countingResendStore) Messages() []QueuedMessage {
+	return s.msgs
+}
+
+func (s *countingResendStore) SetMessages(msgs []QueuedMessage) error {
+	s.msgs = msgs
+	s.saves++
+	return nil
+}
+
+func Test_Conversation_onlySavesTheResendStoreWhenUnsentMessagesChange(t *testing.T) {
+	s := &countingResendStore{}
+	c := &Conversation{}
+	c.SetResendStore(s)
+	assertEquals(t, s.saves, 0)
+
+	c.lastSentMessage(MessagePlaintext("already sent"))
+	c.lastSentMessage(MessagePlaintext("also sent"))
+	c.resend.clear()
+	assertEquals(t, s.saves, 0)
+
+	c.lastMessage(MessagePlaintext("waiting for encryption"))
+	assertEquals(t, s.saves, 1)
+
+	c.expireQueuedMessages(time.Now())
+	assertEquals(t, s.saves, 1)
+
+	c.resend.clear()
+	assertEquals(t, s.saves, 2)
+	assertEquals(t, len(s.msgs), 0)
+}
+
+func Test_Conversation_sendsTheMessagesInTheResendStoreOnceEncryptedAfterARestart(t *testing.T) {
+	queued := time.Now().Add(-time.Minute)
+	s := &countingResendStore{msgs: []QueuedMessage{
+		QueuedMessage{Message: MessagePlaintext("written before the restart"), Queued: queued, Expires: queued.Add(2 * time.Minute)},
+	}}
+
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{})
+	alice.s.Conversation().SetResendStore(s)
+
+	assertNil(t, alice.s.StartEncryption())
+	n.Deliver()
+
+	assertTrue(t, bob.s.Conversation().IsEncrypted())
+	assertDeepEquals(t, bob.received, []MessagePlaintext{MessagePlaintext("written before the restart")})
+	assertEquals(t, len(s.msgs), 0)
+}
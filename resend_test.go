@@ -27,10 +27,18 @@ func Test_shouldRetransmit_returnTrueIfAllTheConditionsForResendingAreMet(t *tes
 	assertEquals(t, c.shouldRetransmit(), true)
 }
 
-func Test_shouldRetransmit_returnFalseIfTheLastMessageWasSentTooFarBackInTime(t *testing.T) {
+func Test_shouldRetransmit_returnTrueForUnexpiredMessagesEvenIfNothingWasSentRecently(t *testing.T) {
 	c := &Conversation{}
 	fixtureCorrectResend(c)
-	c.heartbeat.lastSent = time.Now().Add(-61 * time.Second)
+	c.heartbeat.lastSent = time.Time{}
+
+	assertEquals(t, c.shouldRetransmit(), true)
+}
+
+func Test_shouldRetransmit_returnFalseIfTheQueuedMessageHasExpired(t *testing.T) {
+	c := &Conversation{}
+	fixtureCorrectResend(c)
+	c.resend.messages.m[0].Expires = time.Now().Add(-1 * time.Second)
 
 	assertEquals(t, c.shouldRetransmit(), false)
 }
@@ -234,3 +242,82 @@ func Test_maybeRetransmit_signalMessageEventWhenSendingMessageExact(t *testing.T
 		_, _ = c.maybeRetransmit()
 	}, MessageEventMessageSent, nil, nil)
 }
+
+func Test_maybeRetransmit_signalsAndDropsExpiredMessages(t *testing.T) {
+	c := &Conversation{}
+	fixtureCorrectResend(c)
+	c.resend.messages.m[0].Expires = time.Now().Add(-1 * time.Second)
+
+	c.expectMessageEvent(t, func() {
+		res, err := c.maybeRetransmit()
+		assertNil(t, res)
+		assertNil(t, err)
+	}, MessageEventMessageExpired, nil, nil)
+	assertEquals(t, len(c.resend.pending()), 0)
+}
+
+func Test_maybeRetransmit_doesntSignalExpiryOfMessagesThatHaveAlreadyBeenSent(t *testing.T) {
+	c := &Conversation{}
+	c.lastSentMessage(MessagePlaintext("hello"))
+	c.resend.messages.m[0].Expires = time.Now().Add(-1 * time.Second)
+
+	c.doesntExpectMessageEvent(t, func() {
+		_, _ = c.maybeRetransmit()
+	})
+	assertEquals(t, len(c.resend.pending()), 0)
+}
+
+func Test_SetResendLimits_setsTheExpiryOfQueuedMessages(t *testing.T) {
+	c := &Conversation{}
+	c.SetResendLimits(time.Hour, 0)
+	c.lastMessage(MessagePlaintext("hello"))
+
+	assertTrue(t, c.resend.messages.m[0].Expires.After(time.Now().Add(59*time.Minute)))
+}
+
+func Test_lastMessage_dropsTheOldestMessagesWhenTooManyAreQueued(t *testing.T) {
+	c := &Conversation{}
+	c.SetResendLimits(0, 2)
+	c.lastMessage(MessagePlaintext("one"), "first")
+	c.lastMessage(MessagePlaintext("two"))
+
+	c.expectMessageEvent(t, func() {
+		c.lastMessage(MessagePlaintext("three"))
+	}, MessageEventMessageExpired, nil, nil)
+
+	assertDeepEquals(t, c.resend.pending(), []messageToResend{
+		messageToResend{MessagePlaintext("two"), nil},
+		messageToResend{MessagePlaintext("three"), nil},
+	})
+}
+
+func Test_lastMessage_onlyCountsMessagesWaitingToBeSentAgainstTheLimit(t *testing.T) {
+	c := &Conversation{}
+	c.SetResendLimits(0, 1)
+	c.lastSentMessage(MessagePlaintext("sent"))
+	c.lastSentMessage(MessagePlaintext("also sent"))
+
+	c.doesntExpectMessageEvent(t, func() {
+		c.lastMessage(MessagePlaintext("waiting"))
+	})
+	assertEquals(t, len(c.resend.pending()), 3)
+
+	c.expectMessageEvent(t, func() {
+		c.lastMessage(MessagePlaintext("waiting too"))
+	}, MessageEventMessageExpired, nil, nil)
+	assertDeepEquals(t, c.resend.pending(), []messageToResend{
+		messageToResend{MessagePlaintext("sent"), nil},
+		messageToResend{MessagePlaintext("also sent"), nil},
+		messageToResend{MessagePlaintext("waiting too"), nil},
+	})
+}
+
+func Test_Tick_dropsExpiredMessages(t *testing.T) {
+	c := &Conversation{}
+	c.lastMessage(MessagePlaintext("hello"))
+
+	c.expectMessageEvent(t, func() {
+		_, _ = c.Tick(time.Now().Add(61 * time.Second))
+	}, MessageEventMessageExpired, nil, nil)
+	assertEquals(t, len(c.resend.pending()), 0)
+}
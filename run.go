@@ -0,0 +1,226 @@
+package otr3
+
+import (
+	"context"
+	"time"
+)
+
+// CommandKind decides what a Command given to Run does
+type CommandKind int
+
+const (
+	// CommandStartAKE sends a query message to the peer, asking it to start the AKE
+	CommandStartAKE CommandKind = iota
+	// CommandEnd ends the encrypted conversation, as End does
+	CommandEnd
+	// CommandStartSMP starts authenticating the peer with the Question and Secret of the command
+	CommandStartSMP
+	// CommandProvideSMPSecret answers an SMP started by the peer with the Secret of the command
+	CommandProvideSMPSecret
+	// CommandAbortSMP aborts the SMP in progress
+	CommandAbortSMP
+	// CommandTick sends heartbeats and expires queued messages, as Tick does at the time Now of the command
+	CommandTick
+	// CommandRefresh runs the AKE again for an encrypted conversation, as Refresh does
+	CommandRefresh
+)
+
+// String returns the string representation of the CommandKind
+func (k CommandKind) String() string {
+	switch k {
+	case CommandStartAKE:
+		return "CommandStartAKE"
+	case CommandEnd:
+		return "CommandEnd"
+	case CommandStartSMP:
+		return "CommandStartSMP"
+	case CommandProvideSMPSecret:
+		return "CommandProvideSMPSecret"
+	case CommandAbortSMP:
+		return "CommandAbortSMP"
+	case CommandTick:
+		return "CommandTick"
+	case CommandRefresh:
+		return "CommandRefresh"
+	default:
+		return "COMMAND KIND: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// Command is a control command for a conversation managed by Run
+type Command struct {
+	Kind     CommandKind
+	Question string
+	Secret   []byte
+	Now      time.Time
+}
+
+// RunEventKind decides which fields of a RunEvent are set
+type RunEventKind int
+
+const (
+	// RunEventSend means that Message should be sent to the peer
+	RunEventSend RunEventKind = iota
+	// RunEventReceived means that Plaintext was received from the peer and should be shown to the user
+	RunEventReceived
+	// RunEventMessage carries a MessageEvent, together with its Data, Err and Trace
+	RunEventMessage
+	// RunEventSMP carries an SMPEvent, together with its ProgressPercent and Question
+	RunEventSMP
+	// RunEventSecurity carries a SecurityEvent
+	RunEventSecurity
+	// RunEventError means that handling an inbound message, an outbound plaintext or a command failed with Err
+	RunEventError
+)
+
+// String returns the string representation of the RunEventKind
+func (k RunEventKind) String() string {
+	switch k {
+	case RunEventSend:
+		return "RunEventSend"
+	case RunEventReceived:
+		return "RunEventReceived"
+	case RunEventMessage:
+		return "RunEventMessage"
+	case RunEventSMP:
+		return "RunEventSMP"
+	case RunEventSecurity:
+		return "RunEventSecurity"
+	case RunEventError:
+		return "RunEventError"
+	default:
+		return "RUN EVENT KIND: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// RunEvent is everything a conversation managed by Run reports back
+type RunEvent struct {
+	Kind RunEventKind
+
+	Message   ValidMessage
+	Plaintext MessagePlaintext
+
+	MessageEvent MessageEvent
+	Data         []byte
+	Trace        []interface{}
+
+	SMPEvent        SMPEvent
+	ProgressPercent int
+	Question        string
+
+	SecurityEvent SecurityEvent
+
+	Err error
+}
+
+// RunChannels are the channels a conversation managed by Run communicates over.
+// Inbound takes messages received from the network, Outbound takes plaintexts typed by the user and Control takes
+// commands. A nil channel is never read from.
+type RunChannels struct {
+	Inbound  <-chan ValidMessage
+	Outbound <-chan ValidMessage
+	Control  <-chan Command
+	Events   chan<- RunEvent
+}
+
+// Run handles the messages and commands arriving on the given channels one at a time, using Send, Receive and the
+// other methods of the conversation, and reports everything that happens as RunEvents. Messages to send to the peer
+// are reported as RunEventSend, so the caller only has to forward those to the network.
+//
+// While Run is running, the SMP, message and security event handlers of the conversation are replaced, and the
+// conversation must not be used from any other goroutine. Run returns the error of the context when it is done,
+// or nil when the Inbound, Outbound and Control channels have all been closed. It never closes the Events channel.
+func (c *Conversation) Run(ctx context.Context, ch RunChannels) error {
+	r := &runner{ctx: ctx, events: ch.Events}
+
+	smpEventHandler, messageEventHandler, securityEventHandler := c.smpEventHandler, c.messageEventHandler, c.securityEventHandler
+	c.smpEventHandler, c.messageEventHandler, c.securityEventHandler = r, r, r
+	defer func() {
+		c.smpEventHandler, c.messageEventHandler, c.securityEventHandler = smpEventHandler, messageEventHandler, securityEventHandler
+	}()
+
+	inbound, outbound, control := ch.Inbound, ch.Outbound, ch.Control
+	for inbound != nil || outbound != nil || control != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m, ok := <-inbound:
+			if !ok {
+				inbound = nil
+				continue
+			}
+			plain, toSend, err := c.ReceiveContext(ctx, m)
+			if len(plain) > 0 {
+				r.emit(RunEvent{Kind: RunEventReceived, Plaintext: plain})
+			}
+			r.sendAll(toSend, err)
+		case m, ok := <-outbound:
+			if !ok {
+				outbound = nil
+				continue
+			}
+			r.sendAll(c.SendContext(ctx, m))
+		case cmd, ok := <-control:
+			if !ok {
+				control = nil
+				continue
+			}
+			r.sendAll(c.runCommand(cmd))
+		}
+	}
+
+	return nil
+}
+
+func (c *Conversation) runCommand(cmd Command) ([]ValidMessage, error) {
+	switch cmd.Kind {
+	case CommandStartAKE:
+		return []ValidMessage{c.QueryMessage()}, nil
+	case CommandEnd:
+		return c.End()
+	case CommandStartSMP:
+		return c.StartAuthenticate(cmd.Question, cmd.Secret)
+	case CommandProvideSMPSecret:
+		return c.ProvideAuthenticationSecret(cmd.Secret)
+	case CommandAbortSMP:
+		return c.AbortAuthentication()
+	case CommandTick:
+		return c.Tick(cmd.Now)
+	case CommandRefresh:
+		return c.Refresh()
+	}
+	return nil, newOtrErrorf("unknown command: %s", cmd.Kind)
+}
+
+type runner struct {
+	ctx    context.Context
+	events chan<- RunEvent
+}
+
+func (r *runner) emit(e RunEvent) {
+	select {
+	case r.events <- e:
+	case <-r.ctx.Done():
+	}
+}
+
+func (r *runner) sendAll(toSend []ValidMessage, err error) {
+	for _, m := range toSend {
+		r.emit(RunEvent{Kind: RunEventSend, Message: m})
+	}
+	if err != nil && r.ctx.Err() == nil {
+		r.emit(RunEvent{Kind: RunEventError, Err: err})
+	}
+}
+
+func (r *runner) HandleSMPEvent(event SMPEvent, progressPercent int, question string) {
+	r.emit(RunEvent{Kind: RunEventSMP, SMPEvent: event, ProgressPercent: progressPercent, Question: question})
+}
+
+func (r *runner) HandleMessageEvent(event MessageEvent, message []byte, err error, trace ...interface{}) {
+	r.emit(RunEvent{Kind: RunEventMessage, MessageEvent: event, Data: append([]byte(nil), message...), Err: err, Trace: trace})
+}
+
+func (r *runner) HandleSecurityEvent(event SecurityEvent) {
+	r.emit(RunEvent{Kind: RunEventSecurity, SecurityEvent: event})
+}
@@ -0,0 +1,147 @@
+package otr3
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type running struct {
+	inbound  chan ValidMessage
+	outbound chan ValidMessage
+	control  chan Command
+	events   chan RunEvent
+	done     chan error
+}
+
+func startRunning(ctx context.Context, c *Conversation) *running {
+	r := &running{
+		inbound:  make(chan ValidMessage, 10),
+		outbound: make(chan ValidMessage, 10),
+		control:  make(chan Command, 10),
+		events:   make(chan RunEvent, 10),
+		done:     make(chan error, 1),
+	}
+	go func() {
+		r.done <- c.Run(ctx, RunChannels{Inbound: r.inbound, Outbound: r.outbound, Control: r.control, Events: r.events})
+	}()
+	return r
+}
+
+// pumpUntil forwards the messages to send between the two running conversations until stop returns true
+// for an event from one of them
+func pumpUntil(t *testing.T, alice, bob *running, stop func(from *running, e RunEvent) bool) {
+	timeout := time.After(10 * time.Second)
+	for {
+		var from, to *running
+		var e RunEvent
+		select {
+		case e = <-alice.events:
+			from, to = alice, bob
+		case e = <-bob.events:
+			from, to = bob, alice
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+		}
+
+		if e.Kind == RunEventSend {
+			to.inbound <- e.Message
+		}
+		if stop(from, e) {
+			return
+		}
+	}
+}
+
+func Test_Run_startsTheAKEAndExchangesMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	aliceConv, bobConv := fixtureConversationPair()
+	alice, bob := startRunning(ctx, aliceConv), startRunning(ctx, bobConv)
+
+	alice.control <- Command{Kind: CommandStartAKE}
+	secure := map[*running]bool{}
+	pumpUntil(t, alice, bob, func(from *running, e RunEvent) bool {
+		if e.Kind == RunEventSecurity && e.SecurityEvent == GoneSecure {
+			secure[from] = true
+		}
+		return len(secure) == 2
+	})
+
+	alice.outbound <- ValidMessage("hello")
+	var received MessagePlaintext
+	pumpUntil(t, alice, bob, func(from *running, e RunEvent) bool {
+		received = e.Plaintext
+		return from == bob && e.Kind == RunEventReceived
+	})
+	assertDeepEquals(t, received, MessagePlaintext("hello"))
+
+	bob.control <- Command{Kind: CommandEnd}
+	pumpUntil(t, alice, bob, func(from *running, e RunEvent) bool {
+		return from == alice && e.Kind == RunEventSecurity && e.SecurityEvent == GoneInsecure
+	})
+
+	cancel()
+	assertEquals(t, <-alice.done, context.Canceled)
+	assertEquals(t, <-bob.done, context.Canceled)
+}
+
+func Test_Run_reportsSMPEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	aliceConv, bobConv := fixtureEncryptedConversations()
+	alice, bob := startRunning(ctx, aliceConv), startRunning(ctx, bobConv)
+
+	alice.control <- Command{Kind: CommandStartSMP, Question: "color?", Secret: []byte("blue")}
+	pumpUntil(t, alice, bob, func(from *running, e RunEvent) bool {
+		if from == bob && e.Kind == RunEventSMP && e.SMPEvent == SMPEventAskForAnswer {
+			assertEquals(t, e.Question, "color?")
+			bob.control <- Command{Kind: CommandProvideSMPSecret, Secret: []byte("blue")}
+		}
+		return from == alice && e.Kind == RunEventSMP && e.SMPEvent == SMPEventSuccess
+	})
+}
+
+func Test_Run_reportsErrorsAndMessageEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := fixtureConversationPair()
+	c.Policies.RequireEncryption()
+	r := startRunning(ctx, c)
+
+	r.inbound <- ValidMessage("plain hello")
+	e := <-r.events
+	assertEquals(t, e.Kind, RunEventMessage)
+	assertEquals(t, e.MessageEvent, MessageEventReceivedMessageUnencrypted)
+	assertDeepEquals(t, e.Data, []byte("plain hello"))
+
+	e = <-r.events
+	assertEquals(t, e.Kind, RunEventReceived)
+	assertDeepEquals(t, e.Plaintext, MessagePlaintext("plain hello"))
+
+	r.control <- Command{Kind: CommandKind(42)}
+	e = <-r.events
+	assertEquals(t, e.Kind, RunEventError)
+	assertDeepEquals(t, e.Err, newOtrErrorf("unknown command: %s", CommandKind(42)))
+}
+
+func Test_Run_returnsWhenAllInputsAreClosedAndRestoresTheHandlers(t *testing.T) {
+	c, _ := fixtureConversationPair()
+	c.SetSecurityEventHandler(DebugSecurityEventHandler{})
+	r := startRunning(context.Background(), c)
+
+	close(r.inbound)
+	close(r.outbound)
+	close(r.control)
+
+	assertNil(t, <-r.done)
+	assertEquals(t, c.securityEventHandler, SecurityEventHandler(DebugSecurityEventHandler{}))
+}
+
+func Test_RunEventKind_String(t *testing.T) {
+	assertEquals(t, RunEventSend.String(), "RunEventSend")
+	assertEquals(t, RunEventError.String(), "RunEventError")
+	assertEquals(t, RunEventKind(42).String(), "RUN EVENT KIND: (THIS SHOULD NEVER HAPPEN)")
+	assertEquals(t, CommandTick.String(), "CommandTick")
+	assertEquals(t, CommandKind(42).String(), "COMMAND KIND: (THIS SHOULD NEVER HAPPEN)")
+}
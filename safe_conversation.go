@@ -0,0 +1,330 @@
+package otr3
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// SafeConversation wraps a Conversation so that it can be used from several goroutines at the same time,
+// for example with one goroutine sending messages typed by the user and another one receiving messages
+// from the network. All methods are serialized with a lock.
+//
+// Message events, SMP events, security events and received symmetric keys are collected while the lock is
+// held, and handed to the handlers set on the SafeConversation after it has been released. The handlers
+// can therefore call back into the SafeConversation without deadlocking. They are called on the goroutine
+// whose call caused the events. The ErrorMessageHandler is the exception, since the conversation needs the
+// error message it returns - it is called with the lock held and must not call into the SafeConversation.
+type SafeConversation struct {
+	lock    sync.Mutex
+	c       *Conversation
+	pending []func()
+
+	smpEventHandler      SMPEventHandler
+	messageEventHandler  MessageEventHandler
+	securityEventHandler SecurityEventHandler
+	receivedKeyHandler   ReceivedKeyHandler
+}
+
+// NewSafeConversation wraps the given conversation. The event handlers already set on the conversation are
+// moved to the SafeConversation. The conversation should not be used directly after this, except through Do.
+func NewSafeConversation(c *Conversation) *SafeConversation {
+	s := &SafeConversation{
+		c:                    c,
+		smpEventHandler:      c.smpEventHandler,
+		messageEventHandler:  c.messageEventHandler,
+		securityEventHandler: c.securityEventHandler,
+		receivedKeyHandler:   c.receivedKeyHandler,
+	}
+
+	d := deferredHandlers{s}
+	c.smpEventHandler = d
+	c.messageEventHandler = d
+	c.securityEventHandler = d
+	c.receivedKeyHandler = d
+
+	return s
+}
+
+// withLock runs f with the lock held, and afterwards delivers the events it generated
+func (s *SafeConversation) withLock(f func()) {
+	for _, e := range s.runLocked(f) {
+		e()
+	}
+}
+
+// runLocked runs f with the lock held and returns the events it generated. The lock is released even if f panics.
+func (s *SafeConversation) runLocked(f func()) (events []func()) {
+	s.lock.Lock()
+	defer func() {
+		events = s.pending
+		s.pending = nil
+		s.lock.Unlock()
+	}()
+
+	f()
+	return
+}
+
+// Do calls f with the wrapped conversation while holding the lock. It can be used to configure the conversation
+// or to call methods that the SafeConversation doesn't wrap. The conversation must not be kept after f returns.
+func (s *SafeConversation) Do(f func(c *Conversation)) {
+	s.withLock(func() {
+		f(s.c)
+	})
+}
+
+// Send is the same as Conversation.Send
+func (s *SafeConversation) Send(m ValidMessage, trace ...interface{}) (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.Send(m, trace...)
+	})
+	return
+}
+
+// SendContext is the same as Conversation.SendContext
+func (s *SafeConversation) SendContext(ctx context.Context, m ValidMessage, trace ...interface{}) (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.SendContext(ctx, m, trace...)
+	})
+	return
+}
+
+// Receive is the same as Conversation.Receive
+func (s *SafeConversation) Receive(m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		plain, toSend, err = s.c.Receive(m)
+	})
+	return
+}
+
+// ReceiveContext is the same as Conversation.ReceiveContext
+func (s *SafeConversation) ReceiveContext(ctx context.Context, m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		plain, toSend, err = s.c.ReceiveContext(ctx, m)
+	})
+	return
+}
+
+// Tick is the same as Conversation.Tick
+func (s *SafeConversation) Tick(now time.Time) (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.Tick(now)
+	})
+	return
+}
+
+// End is the same as Conversation.End
+func (s *SafeConversation) End() (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.End()
+	})
+	return
+}
+
+// StartAKE is the same as Conversation.StartAKE
+func (s *SafeConversation) StartAKE(version int) (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.StartAKE(version)
+	})
+	return
+}
+
+// Refresh is the same as Conversation.Refresh
+func (s *SafeConversation) Refresh() (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.Refresh()
+	})
+	return
+}
+
+// StartAuthenticate is the same as Conversation.StartAuthenticate
+func (s *SafeConversation) StartAuthenticate(question string, mutualSecret []byte) (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.StartAuthenticate(question, mutualSecret)
+	})
+	return
+}
+
+// StartAuthenticateSession is the same as Conversation.StartAuthenticateSession
+func (s *SafeConversation) StartAuthenticateSession(question string, mutualSecret []byte) (session *SMPSession, toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		session, toSend, err = s.c.StartAuthenticateSession(question, mutualSecret)
+	})
+	return
+}
+
+// ProvideAuthenticationSecret is the same as Conversation.ProvideAuthenticationSecret
+func (s *SafeConversation) ProvideAuthenticationSecret(mutualSecret []byte) (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.ProvideAuthenticationSecret(mutualSecret)
+	})
+	return
+}
+
+// AbortAuthentication is the same as Conversation.AbortAuthentication
+func (s *SafeConversation) AbortAuthentication() (toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		toSend, err = s.c.AbortAuthentication()
+	})
+	return
+}
+
+// SMPQuestion is the same as Conversation.SMPQuestion
+func (s *SafeConversation) SMPQuestion() (question string, ok bool) {
+	s.withLock(func() {
+		question, ok = s.c.SMPQuestion()
+	})
+	return
+}
+
+// UseExtraSymmetricKey is the same as Conversation.UseExtraSymmetricKey
+func (s *SafeConversation) UseExtraSymmetricKey(usage uint32, usageData []byte) (key []byte, toSend []ValidMessage, err error) {
+	s.withLock(func() {
+		key, toSend, err = s.c.UseExtraSymmetricKey(usage, usageData)
+	})
+	return
+}
+
+// QueryMessage is the same as Conversation.QueryMessage
+func (s *SafeConversation) QueryMessage() (m ValidMessage) {
+	s.withLock(func() {
+		m = s.c.QueryMessage()
+	})
+	return
+}
+
+// IsEncrypted is the same as Conversation.IsEncrypted
+func (s *SafeConversation) IsEncrypted() (encrypted bool) {
+	s.withLock(func() {
+		encrypted = s.c.IsEncrypted()
+	})
+	return
+}
+
+// GetTheirKey is the same as Conversation.GetTheirKey
+func (s *SafeConversation) GetTheirKey() (key PublicKey) {
+	s.withLock(func() {
+		key = s.c.GetTheirKey()
+	})
+	return
+}
+
+// GetSSID is the same as Conversation.GetSSID
+func (s *SafeConversation) GetSSID() (ssid [8]byte) {
+	s.withLock(func() {
+		ssid = s.c.GetSSID()
+	})
+	return
+}
+
+// SecureSessionID is the same as Conversation.SecureSessionID
+func (s *SafeConversation) SecureSessionID() (parts []string, highlightIndex int) {
+	s.withLock(func() {
+		parts, highlightIndex = s.c.SecureSessionID()
+	})
+	return
+}
+
+// TrustLevel is the same as Conversation.TrustLevel
+func (s *SafeConversation) TrustLevel() (level TrustLevel) {
+	s.withLock(func() {
+		level = s.c.TrustLevel()
+	})
+	return
+}
+
+// Snapshot is the same as Conversation.Snapshot
+func (s *SafeConversation) Snapshot() (snapshot Snapshot) {
+	s.withLock(func() {
+		snapshot = s.c.Snapshot()
+	})
+	return
+}
+
+// ExportState is the same as Conversation.ExportState
+func (s *SafeConversation) ExportState(w io.Writer, passphrase []byte) (err error) {
+	s.withLock(func() {
+		err = s.c.ExportState(w, passphrase)
+	})
+	return
+}
+
+// SetSMPEventHandler assigns handler for SMPEvent
+func (s *SafeConversation) SetSMPEventHandler(handler SMPEventHandler) {
+	s.withLock(func() {
+		s.smpEventHandler = handler
+	})
+}
+
+// SetErrorMessageHandler assigns handler for ErrorMessage. It is called with the lock held.
+func (s *SafeConversation) SetErrorMessageHandler(handler ErrorMessageHandler) {
+	s.withLock(func() {
+		s.c.SetErrorMessageHandler(handler)
+	})
+}
+
+// SetMessageEventHandler assigns handler for MessageEvent
+func (s *SafeConversation) SetMessageEventHandler(handler MessageEventHandler) {
+	s.withLock(func() {
+		s.messageEventHandler = handler
+	})
+}
+
+// SetSecurityEventHandler assigns handler for SecurityEvent
+func (s *SafeConversation) SetSecurityEventHandler(handler SecurityEventHandler) {
+	s.withLock(func() {
+		s.securityEventHandler = handler
+	})
+}
+
+// SetReceivedKeyHandler will set the handler for what is to happen when an extra symmetric key is received.
+// The key given to the handler is wiped when it returns, so the handler has to copy it to keep it.
+func (s *SafeConversation) SetReceivedKeyHandler(keyHandler ReceivedKeyHandler) {
+	s.withLock(func() {
+		s.receivedKeyHandler = keyHandler
+	})
+}
+
+// deferredHandlers is installed as the event handlers of a wrapped conversation. It is only called with the
+// lock of the SafeConversation held, and queues the events for delivery once the lock has been released.
+type deferredHandlers struct {
+	s *SafeConversation
+}
+
+func (d deferredHandlers) HandleSMPEvent(event SMPEvent, progressPercent int, question string) {
+	if h := d.s.smpEventHandler; h != nil {
+		d.s.pending = append(d.s.pending, func() {
+			h.HandleSMPEvent(event, progressPercent, question)
+		})
+	}
+}
+
+func (d deferredHandlers) HandleMessageEvent(event MessageEvent, message []byte, err error, trace ...interface{}) {
+	if h := d.s.messageEventHandler; h != nil {
+		message = append([]byte(nil), message...)
+		d.s.pending = append(d.s.pending, func() {
+			h.HandleMessageEvent(event, message, err, trace...)
+		})
+	}
+}
+
+func (d deferredHandlers) HandleSecurityEvent(event SecurityEvent) {
+	if h := d.s.securityEventHandler; h != nil {
+		d.s.pending = append(d.s.pending, func() {
+			h.HandleSecurityEvent(event)
+		})
+	}
+}
+
+func (d deferredHandlers) ReceivedSymmetricKey(usage uint32, usageData []byte, symkey []byte) {
+	if h := d.s.receivedKeyHandler; h != nil {
+		usageData = append([]byte(nil), usageData...)
+		symkey = append([]byte(nil), symkey...)
+		d.s.pending = append(d.s.pending, func() {
+			h.ReceivedSymmetricKey(usage, usageData, symkey)
+			wipeBytes(symkey)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package otr3
+
+import (
+	"sync"
+	"testing"
+)
+
+func newSafePair(t *testing.T) (*SafeConversation, *SafeConversation) {
+	alice, bob := fixtureEncryptedConversations()
+	return NewSafeConversation(alice), NewSafeConversation(bob)
+}
+
+// deliver receives everything arriving on in, and passes on the messages the receiver wants to send
+func deliver(t *testing.T, wg *sync.WaitGroup, to *SafeConversation, in <-chan ValidMessage, out chan<- ValidMessage, received *[]string) {
+	defer wg.Done()
+	for m := range in {
+		plain, toSend, err := to.Receive(m)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if plain != nil {
+			*received = append(*received, string(plain))
+		}
+		for _, ts := range toSend {
+			out <- ts
+		}
+	}
+}
+
+func Test_SafeConversation_canSendAndReceiveAtTheSameTimeFromDifferentGoroutines(t *testing.T) {
+	alice, bob := newSafePair(t)
+	const count = 50
+
+	toAlice := make(chan ValidMessage, 4*count)
+	toBob := make(chan ValidMessage, 4*count)
+	var receivers, senders sync.WaitGroup
+	var aliceReceived, bobReceived []string
+
+	receivers.Add(2)
+	go deliver(t, &receivers, alice, toAlice, toBob, &aliceReceived)
+	go deliver(t, &receivers, bob, toBob, toAlice, &bobReceived)
+
+	send := func(from *SafeConversation, out chan<- ValidMessage, msg string) {
+		defer senders.Done()
+		for i := 0; i < count; i++ {
+			toSend, err := from.Send(ValidMessage(msg))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			for _, ts := range toSend {
+				out <- ts
+			}
+		}
+	}
+
+	senders.Add(2)
+	go send(alice, toBob, "ping")
+	go send(bob, toAlice, "pong")
+	senders.Wait()
+
+	close(toAlice)
+	close(toBob)
+	receivers.Wait()
+
+	assertEquals(t, len(bobReceived), count)
+	assertEquals(t, len(aliceReceived), count)
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+}
+
+func Test_SafeConversation_serializesControlMethodsWithSendAndReceive(t *testing.T) {
+	alice, bob := newSafePair(t)
+	var wg sync.WaitGroup
+
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_, _ = alice.Send(ValidMessage("hello"))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_, _, _ = alice.UseExtraSymmetricKey(1, []byte("file"))
+			_ = alice.Snapshot()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			_, _ = alice.StartAuthenticate("", []byte("secret"))
+			_, _ = alice.AbortAuthentication()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		toSend, _ := bob.Send(ValidMessage("hi"))
+		for _, m := range toSend {
+			_, _, _ = alice.Receive(m)
+		}
+		_, _ = alice.End()
+	}()
+	wg.Wait()
+
+	assertFalse(t, alice.IsEncrypted())
+}
+
+func Test_SafeConversation_callsHandlersOutsideOfTheLock(t *testing.T) {
+	alice, bob := newSafePair(t)
+
+	var encryptedDuringEvent []bool
+	bob.SetSecurityEventHandler(dynamicSecurityEventHandler{func(event SecurityEvent) {
+		encryptedDuringEvent = append(encryptedDuringEvent, bob.IsEncrypted())
+	}})
+
+	toSend, err := alice.End()
+	assertNil(t, err)
+	_, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+
+	assertDeepEquals(t, encryptedDuringEvent, []bool{false})
+}
+
+func Test_SafeConversation_takesOverTheHandlersOfTheConversation(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+
+	var received []SecurityEvent
+	bob.SetSecurityEventHandler(dynamicSecurityEventHandler{func(event SecurityEvent) {
+		received = append(received, event)
+	}})
+	safeBob := NewSafeConversation(bob)
+
+	toSend, err := alice.End()
+	assertNil(t, err)
+	_, _, err = safeBob.Receive(toSend[0])
+	assertNil(t, err)
+
+	assertDeepEquals(t, received, []SecurityEvent{GoneInsecure})
+}
+
+func Test_SafeConversation_deliversMessageEventsWithACopyOfTheMessage(t *testing.T) {
+	alice, _ := newSafePair(t)
+
+	var messages [][]byte
+	alice.SetMessageEventHandler(dynamicMessageEventHandler{func(event MessageEvent, message []byte, err error, trace ...interface{}) {
+		messages = append(messages, message)
+	}})
+
+	received := ValidMessage("hello")
+	_, _, err := alice.Receive(received)
+	assertNil(t, err)
+	received[0] = 'j'
+
+	assertDeepEquals(t, messages, [][]byte{[]byte("hello")})
+}
+
+func Test_SafeConversation_releasesTheLockWhenTheCallPanics(t *testing.T) {
+	alice, _ := newSafePair(t)
+
+	func() {
+		defer func() {
+			assertNotNil(t, recover())
+		}()
+		alice.Do(func(c *Conversation) {
+			panic("in the middle of a call")
+		})
+	}()
+
+	toSend, err := alice.Send(ValidMessage("still usable"))
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+}
+
+func Test_SafeConversation_wipesItsCopyOfAReceivedSymmetricKeyAfterTheHandler(t *testing.T) {
+	alice, bob := newSafePair(t)
+
+	var seen, held []byte
+	bob.SetReceivedKeyHandler(dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		seen = append([]byte(nil), symkey...)
+		held = symkey
+	}})
+
+	key, toSend, err := alice.UseExtraSymmetricKey(1, []byte("usage"))
+	assertNil(t, err)
+	_, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+
+	assertDeepEquals(t, seen, key)
+	assertDeepEquals(t, held, make([]byte, len(key)))
+}
@@ -2,7 +2,8 @@ package otr3
 
 import "fmt"
 
-// SecurityEvent define the events used to indicate changes in security status. In comparison with libotr, this library does not take trust levels into concern for security events
+// SecurityEvent define the events used to indicate changes in security status.
+// The trust level of the peer can be checked with Conversation.TrustLevel when handling these events
 type SecurityEvent int
 
 const (
@@ -12,6 +13,12 @@ const (
 	GoneSecure
 	// StillSecure is signalled when we have refreshed the security state but is still in a secure state
 	StillSecure
+	// GoneVerified is signalled when a successful SMP run has made the fingerprint of the peer trusted. If a trust store
+	// is set, it is also signalled after GoneSecure and StillSecure when the fingerprint of the peer is trusted
+	GoneVerified
+	// GoneUnverified is signalled after GoneSecure and StillSecure when a trust store is set and the fingerprint of the
+	// peer is not trusted
+	GoneUnverified
 )
 
 // SecurityEventHandler is an interface for events that are related to changes of security status
@@ -43,6 +50,10 @@ func (s SecurityEvent) String() string {
 		return "GoneSecure"
 	case StillSecure:
 		return "StillSecure"
+	case GoneVerified:
+		return "GoneVerified"
+	case GoneUnverified:
+		return "GoneUnverified"
 	default:
 		return "SECURITY EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
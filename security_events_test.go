@@ -6,6 +6,8 @@ func Test_SecurityEvent_hasValidStringImplementation(t *testing.T) {
 	assertEquals(t, GoneInsecure.String(), "GoneInsecure")
 	assertEquals(t, GoneSecure.String(), "GoneSecure")
 	assertEquals(t, StillSecure.String(), "StillSecure")
+	assertEquals(t, GoneVerified.String(), "GoneVerified")
+	assertEquals(t, GoneUnverified.String(), "GoneUnverified")
 	assertEquals(t, SecurityEvent(20000).String(), "SECURITY EVENT: (THIS SHOULD NEVER HAPPEN)")
 }
 
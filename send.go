@@ -11,6 +11,8 @@ func (c *Conversation) Send(m ValidMessage, trace ...interface{}) ([]ValidMessag
 	message := makeCopy(m)
 	defer wipeBytes(message)
 
+	c.resolvePolicies()
+
 	if !c.Policies.isOTREnabled() {
 		return []ValidMessage{makeCopy(message)}, nil
 	}
@@ -35,6 +37,7 @@ func (c *Conversation) Send(m ValidMessage, trace ...interface{}) ([]ValidMessag
 
 func (c *Conversation) sendMessageOnPlaintext(message ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
 	if c.Policies.has(requireEncryption) {
+		c.logDebug("message queued until encrypted, as required by policy")
 		c.messageEvent(MessageEventEncryptionRequired, trace...)
 		c.updateLastSent()
 		c.updateMayRetransmitTo(retransmitExact)
@@ -70,6 +73,7 @@ func (c *Conversation) sendDHCommit() (toSend messageWithHeader, err error) {
 	}
 
 	c.ake.state = authStateAwaitingDHKey{}
+	c.logDebug("AKE started", "to", c.akeStateName())
 
 	return
 }
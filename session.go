@@ -0,0 +1,100 @@
+package otr3
+
+import "time"
+
+// Transport delivers messages to a peer over some network
+type Transport interface {
+	// Send delivers the message to the peer
+	Send(ValidMessage) error
+}
+
+// Session binds a Conversation to a Transport. Every message the conversation wants to send through the methods of
+// the session - including messages in response to received messages, injected messages, heartbeats and
+// retransmissions - is sent over the transport by the session. Messages returned by methods called directly on the
+// conversation have to be sent by the caller.
+type Session struct {
+	c *Conversation
+	t Transport
+}
+
+// NewSession creates a new session sending the messages of the conversation over the transport
+func NewSession(c *Conversation, t Transport) *Session {
+	return &Session{c: c, t: t}
+}
+
+// Conversation returns the conversation of this session
+func (s *Session) Conversation() *Conversation {
+	return s.c
+}
+
+// Send sends a human readable message from the local user to the peer, encrypting it if necessary
+func (s *Session) Send(msg ValidMessage, trace ...interface{}) error {
+	return s.transmitAll(s.c.Send(msg, trace...))
+}
+
+// Receive handles a message received from the peer over the transport, sends all the responses the conversation generates,
+// and returns the human readable message, if any
+func (s *Session) Receive(msg ValidMessage) (MessagePlaintext, error) {
+	plain, toSend, err := s.c.Receive(msg)
+	if e := s.transmit(toSend); err == nil {
+		err = e
+	}
+	return plain, err
+}
+
+// StartEncryption sends a query message to the peer, to start an AKE
+func (s *Session) StartEncryption() error {
+	return s.t.Send(s.c.QueryMessage())
+}
+
+// End ends the secure conversation, and tells the peer about it
+func (s *Session) End() error {
+	return s.transmitAll(s.c.End())
+}
+
+// StartAKE starts the AKE with the given protocol version without sending a query message first, like Conversation.StartAKE
+func (s *Session) StartAKE(version int) error {
+	return s.transmitAll(s.c.StartAKE(version))
+}
+
+// Refresh runs the AKE again for the encrypted conversation, like Conversation.Refresh
+func (s *Session) Refresh() error {
+	return s.transmitAll(s.c.Refresh())
+}
+
+// Tick should be called regularly with the current time, like Conversation.Tick. It sends a heartbeat to the peer if one is due.
+func (s *Session) Tick(now time.Time) error {
+	return s.transmitAll(s.c.Tick(now))
+}
+
+// StartAuthenticate starts the SMP with the peer, optionally asking the given question
+func (s *Session) StartAuthenticate(question string, mutualSecret []byte) error {
+	return s.transmitAll(s.c.StartAuthenticate(question, mutualSecret))
+}
+
+// ProvideAuthenticationSecret answers the SMP started by the peer with our secret
+func (s *Session) ProvideAuthenticationSecret(mutualSecret []byte) error {
+	return s.transmitAll(s.c.ProvideAuthenticationSecret(mutualSecret))
+}
+
+// AbortAuthentication aborts the SMP in progress, and tells the peer about it
+func (s *Session) AbortAuthentication() error {
+	return s.transmitAll(s.c.AbortAuthentication())
+}
+
+// transmitAll sends the messages returned by a method of the conversation, and returns the first error of either
+func (s *Session) transmitAll(toSend []ValidMessage, err error) error {
+	if e := s.transmit(toSend); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (s *Session) transmit(msgs []ValidMessage) error {
+	for _, m := range msgs {
+		if err := s.t.Send(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
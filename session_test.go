@@ -0,0 +1,174 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+type loopbackPeer struct {
+	s        *Session
+	received []MessagePlaintext
+	errors   []error
+}
+
+func newLoopbackPeer(key PrivateKey, t *LoopbackTransport) *loopbackPeer {
+	p := &loopbackPeer{s: NewSession(fixtureConversationWithKey(key), t)}
+	t.SetReceiver(func(m ValidMessage) {
+		plain, err := p.s.Receive(m)
+		if err != nil {
+			p.errors = append(p.errors, err)
+		}
+		if len(plain) > 0 {
+			p.received = append(p.received, plain)
+		}
+	})
+	return p
+}
+
+func newLoopbackPeers(options LoopbackOptions) (*LoopbackNetwork, *loopbackPeer, *loopbackPeer) {
+	n := NewLoopbackNetwork(options, 42)
+	ta, tb := n.Pair()
+	return n, newLoopbackPeer(alicePrivateKey, ta), newLoopbackPeer(bobPrivateKey, tb)
+}
+
+func Test_Session_runsTheAKEAndDeliversMessagesOverTheTransport(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{})
+
+	assertNil(t, alice.s.StartEncryption())
+	n.Deliver()
+
+	assertTrue(t, alice.s.Conversation().IsEncrypted())
+	assertTrue(t, bob.s.Conversation().IsEncrypted())
+
+	assertNil(t, alice.s.Send(ValidMessage("hello")))
+	assertNil(t, bob.s.Send(ValidMessage("hi there")))
+	n.Deliver()
+
+	assertDeepEquals(t, bob.received, []MessagePlaintext{MessagePlaintext("hello")})
+	assertDeepEquals(t, alice.received, []MessagePlaintext{MessagePlaintext("hi there")})
+	assertEquals(t, n.Pending(), 0)
+}
+
+func Test_Session_retransmitsMessagesSentBeforeTheAKEFinished(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{})
+	alice.s.Conversation().Policies.add(requireEncryption)
+
+	assertNil(t, alice.s.Send(ValidMessage("secret")))
+	n.Deliver()
+
+	assertDeepEquals(t, bob.received, []MessagePlaintext{MessagePlaintext("secret")})
+}
+
+func Test_Session_End_tellsThePeer(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{})
+	_ = alice.s.StartEncryption()
+	n.Deliver()
+
+	assertNil(t, alice.s.End())
+	n.Deliver()
+
+	assertFalse(t, alice.s.Conversation().IsEncrypted())
+	assertEquals(t, bob.s.Conversation().msgState, finished)
+}
+
+func Test_Session_runsTheSMPOverTheTransport(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{})
+	_ = alice.s.StartEncryption()
+	n.Deliver()
+
+	var events []SMPEvent
+	alice.s.Conversation().smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) { events = append(events, e) }}
+
+	assertNil(t, alice.s.StartAuthenticate("", []byte("our secret")))
+	n.Deliver()
+	assertNil(t, bob.s.ProvideAuthenticationSecret([]byte("our secret")))
+	n.Deliver()
+
+	assertEquals(t, events[len(events)-1], SMPEventSuccess)
+}
+
+func Test_Session_AbortAuthentication_tellsThePeer(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{})
+	_ = alice.s.StartEncryption()
+	n.Deliver()
+
+	var events []SMPEvent
+	bob.s.Conversation().smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) { events = append(events, e) }}
+
+	assertNil(t, alice.s.StartAuthenticate("", []byte("our secret")))
+	n.Deliver()
+	assertNil(t, alice.s.AbortAuthentication())
+	n.Deliver()
+
+	assertEquals(t, events[len(events)-1], SMPEventAbort)
+	assertEquals(t, bob.s.Conversation().smp.state, smpState(smpStateExpect1{}))
+}
+
+func Test_Session_StartAKE_andRefresh_runTheAKEOverTheTransport(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{})
+
+	assertNil(t, alice.s.StartAKE(3))
+	n.Deliver()
+	assertTrue(t, alice.s.Conversation().IsEncrypted())
+	assertTrue(t, bob.s.Conversation().IsEncrypted())
+	ssid := alice.s.Conversation().GetSSID()
+
+	assertNil(t, alice.s.Refresh())
+	n.Deliver()
+	assertNotEquals(t, alice.s.Conversation().GetSSID(), ssid)
+	assertEquals(t, alice.s.Conversation().GetSSID(), bob.s.Conversation().GetSSID())
+}
+
+func Test_Session_Tick_sendsHeartbeats(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{})
+	_ = alice.s.StartEncryption()
+	n.Deliver()
+
+	assertNil(t, alice.s.Tick(time.Now().Add(time.Hour)))
+	assertEquals(t, n.Pending(), 1)
+	n.Deliver()
+
+	assertNil(t, bob.received)
+	assertNil(t, bob.errors)
+}
+
+func Test_LoopbackNetwork_dropsMessages(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{DropRate: 1})
+	_ = alice.s.Send(ValidMessage("hello"))
+	n.Deliver()
+
+	assertEquals(t, n.Dropped(), 1)
+	assertEquals(t, n.Delivered(), 0)
+	assertEquals(t, len(bob.received), 0)
+}
+
+func Test_LoopbackNetwork_duplicatesMessages(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{DuplicateRate: 1})
+	_ = alice.s.Send(ValidMessage("hello"))
+	n.Deliver()
+
+	assertEquals(t, n.Duplicated(), 1)
+	assertDeepEquals(t, bob.received, []MessagePlaintext{MessagePlaintext("hello"), MessagePlaintext("hello")})
+}
+
+func Test_LoopbackNetwork_reordersMessages(t *testing.T) {
+	n, alice, bob := newLoopbackPeers(LoopbackOptions{ReorderRate: 1})
+	_ = alice.s.Send(ValidMessage("one"))
+	_ = alice.s.Send(ValidMessage("two"))
+	n.Deliver()
+
+	assertDeepEquals(t, bob.received, []MessagePlaintext{MessagePlaintext("two"), MessagePlaintext("one")})
+}
+
+func Test_LoopbackNetwork_isDeterministicForTheSameSeed(t *testing.T) {
+	run := func() []MessagePlaintext {
+		n, alice, bob := newLoopbackPeers(LoopbackOptions{DropRate: 0.3, DuplicateRate: 0.3, ReorderRate: 0.5})
+		for _, m := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			_ = alice.s.Send(ValidMessage(m))
+		}
+		n.Deliver()
+		return bob.received
+	}
+
+	assertDeepEquals(t, run(), run())
+}
@@ -17,6 +17,11 @@ func NewBigNum(s string) BigNum {
 	return BigNum{res}
 }
 
+// NewBigNumFromInt creates a new BigNum with the given value
+func NewBigNumFromInt(v *big.Int) BigNum {
+	return BigNum{v}
+}
+
 // First will cause an error when called on a BigNum
 func (s BigNum) First() Value {
 	panic("not valid to call First on a BigNum")
@@ -40,6 +40,11 @@ func List(values ...Value) Value {
 	return result
 }
 
+// NewCons creates a new Cons cell with the given values
+func NewCons(first, second Value) Cons {
+	return Cons{first, second}
+}
+
 // ReadListStart will expect the start character for an S-Expression list and return false if not encountered
 func ReadListStart(r *bufio.Reader) bool {
 	return expect(r, '(')
@@ -63,12 +68,17 @@ func ReadList(r *bufio.Reader) Value {
 	return result
 }
 
-// ReadListItem recursively read a list item and the next potential item
+// ReadListItem recursively read a list item and the next potential item.
+// A dot followed by a value ends the list with that value, as written for a Cons that isn't a proper list
 func ReadListItem(r *bufio.Reader) Value {
 	ReadWhitespace(r)
 	val, end := ReadValue(r)
 	if end {
 		return Snil{}
 	}
+	if val == Symbol(".") {
+		rest, _ := ReadValue(r)
+		return rest
+	}
 	return Cons{val, ReadListItem(r)}
 }
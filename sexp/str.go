@@ -1,6 +1,11 @@
 package sexp
 
-import "bufio"
+import (
+	"bufio"
+	"strings"
+)
+
+var stringEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "\\r", "\t", "\\t")
 
 // Sstring represents an S-Expression symbol.
 type Sstring string
@@ -15,9 +20,9 @@ func (s Sstring) Second() Value {
 	panic("not valid to call Second on an SString")
 }
 
-// String returns the string quoted as a string in an S-Expression
+// String returns the string quoted as a string in an S-Expression, escaping quotes, backslashes and control characters
 func (s Sstring) String() string {
-	return "\"" + string(s) + "\""
+	return "\"" + stringEscaper.Replace(string(s)) + "\""
 }
 
 // Value returns the string as a string
@@ -35,15 +40,43 @@ func ReadStringEnd(r *bufio.Reader) bool {
 	return expect(r, '"')
 }
 
-// ReadString will read a string from the reader
+// ReadString will read a string from the reader, unescaping the escape sequences written by String
 func ReadString(r *bufio.Reader) Value {
 	ReadWhitespace(r)
 	if !ReadStringStart(r) {
 		return nil
 	}
-	result := ReadDataUntil(r, untilFixed('"'))
-	if !ReadStringEnd(r) {
-		return nil
+
+	result := make([]byte, 0, 10)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil
+		}
+
+		switch c {
+		case '"':
+			return Sstring(result)
+		case '\\':
+			if c, err = r.ReadByte(); err != nil {
+				return nil
+			}
+			result = append(result, unescape(c))
+		default:
+			result = append(result, c)
+		}
+	}
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	default:
+		return c
 	}
-	return Sstring(result)
 }
@@ -0,0 +1,144 @@
+package sexp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+var bigIntType = reflect.TypeOf(big.Int{})
+var valueType = reflect.TypeOf((*Value)(nil)).Elem()
+
+// Unmarshal decodes the value into the struct pointed to by out, using the sexp tags of the struct fields.
+// A struct is decoded from a list that starts with the name of the struct, followed by one list for
+// each field, starting with the symbol given in the sexp tag of that field - the format used by libotr files:
+//
+//	(account (name "alice") (protocol prpl-jabber))
+//
+// Fields of type string, *big.Int and Value are decoded from the single value after the symbol.
+// Fields of struct type, or pointers to structs, are decoded from the whole list of the field.
+// Fields of slice type collect every list with a matching symbol. Lists that match no field are ignored.
+func Unmarshal(v Value, out interface{}) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("sexp: Unmarshal needs a non-nil pointer to a struct")
+	}
+	return unmarshalStruct(v, rv.Elem())
+}
+
+func fieldsByTag(t reflect.Type) map[string]int {
+	result := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("sexp")
+		if tag != "" && tag != "-" {
+			result[tag] = i
+		}
+	}
+	return result
+}
+
+func unmarshalStruct(v Value, out reflect.Value) error {
+	items, ok := listItems(v)
+	if !ok || len(items) == 0 {
+		return fmt.Errorf("sexp: expected a list to decode into %s", out.Type())
+	}
+
+	fields := fieldsByTag(out.Type())
+	for _, entry := range items[1:] {
+		name, ok := entryName(entry)
+		if !ok {
+			continue
+		}
+
+		if i, ok := fields[name]; ok {
+			if err := unmarshalEntry(entry, out.Field(i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func entryName(entry Value) (string, bool) {
+	c, ok := entry.(Cons)
+	if !ok {
+		return "", false
+	}
+	s, ok := c.first.(Symbol)
+	return string(s), ok
+}
+
+func entryValue(entry Value) (Value, error) {
+	items, _ := listItems(entry)
+	if len(items) != 2 {
+		return nil, fmt.Errorf("sexp: expected a single value in %s", format(entry))
+	}
+	return items[1], nil
+}
+
+func unmarshalEntry(entry Value, out reflect.Value) error {
+	switch {
+	case out.Type() == valueType:
+		val, err := entryValue(entry)
+		if err != nil {
+			return err
+		}
+		out.Set(reflect.ValueOf(&val).Elem())
+		return nil
+	case out.Kind() == reflect.Ptr && out.Type().Elem() == bigIntType:
+		return unmarshalBigNum(entry, out)
+	case out.Kind() == reflect.Ptr && out.Type().Elem().Kind() == reflect.Struct:
+		res := reflect.New(out.Type().Elem())
+		if err := unmarshalStruct(entry, res.Elem()); err != nil {
+			return err
+		}
+		out.Set(res)
+		return nil
+	case out.Kind() == reflect.Struct:
+		return unmarshalStruct(entry, out)
+	case out.Kind() == reflect.String:
+		return unmarshalString(entry, out)
+	case out.Kind() == reflect.Slice:
+		res := reflect.New(out.Type().Elem()).Elem()
+		if err := unmarshalEntry(entry, res); err != nil {
+			return err
+		}
+		out.Set(reflect.Append(out, res))
+		return nil
+	}
+
+	return fmt.Errorf("sexp: can't decode into a value of type %s", out.Type())
+}
+
+func unmarshalBigNum(entry Value, out reflect.Value) error {
+	val, err := entryValue(entry)
+	if err != nil {
+		return err
+	}
+
+	bn, ok := val.(BigNum)
+	if !ok || bn.val == nil {
+		return fmt.Errorf("sexp: expected a number in %s", format(entry))
+	}
+	out.Set(reflect.ValueOf(bn.val))
+	return nil
+}
+
+func unmarshalString(entry Value, out reflect.Value) error {
+	val, err := entryValue(entry)
+	if err != nil {
+		return err
+	}
+
+	switch s := val.(type) {
+	case Sstring:
+		out.SetString(string(s))
+	case Symbol:
+		out.SetString(string(s))
+	default:
+		return fmt.Errorf("sexp: expected a string or a symbol in %s", format(entry))
+	}
+	return nil
+}
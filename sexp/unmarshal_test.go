@@ -0,0 +1,78 @@
+package sexp
+
+import (
+	"math/big"
+	"testing"
+)
+
+type testDSAKey struct {
+	P *big.Int `sexp:"p"`
+	Q *big.Int `sexp:"q"`
+}
+
+type testPrivateKey struct {
+	DSA *testDSAKey `sexp:"dsa"`
+}
+
+type testAccount struct {
+	Name     string         `sexp:"name"`
+	Protocol string         `sexp:"protocol"`
+	Key      testPrivateKey `sexp:"private-key"`
+	Other    Value          `sexp:"other"`
+}
+
+type testPrivKeys struct {
+	Accounts []testAccount `sexp:"account"`
+}
+
+func Test_Unmarshal_decodesALibotrStyleFile(t *testing.T) {
+	v := Read(inp(`(privkeys
+  (account
+    (name "alice")
+    (protocol prpl-jabber)
+    (private-key (dsa (p #0A#) (q #0B#)))
+    (unknown 42))
+  (account (name "bob") (other (1 2))))`))
+
+	var res testPrivKeys
+	assertEquals(t, Unmarshal(v, &res), nil)
+	assertEquals(t, len(res.Accounts), 2)
+	assertEquals(t, res.Accounts[0].Name, "alice")
+	assertEquals(t, res.Accounts[0].Protocol, "prpl-jabber")
+	assertDeepEquals(t, res.Accounts[0].Key.DSA.P, big.NewInt(0x0A))
+	assertDeepEquals(t, res.Accounts[0].Key.DSA.Q, big.NewInt(0x0B))
+	assertEquals(t, res.Accounts[1].Name, "bob")
+	assertEquals(t, res.Accounts[1].Key.DSA, (*testDSAKey)(nil))
+	assertDeepEquals(t, res.Accounts[1].Other, List(Symbol("1"), Symbol("2")))
+}
+
+func Test_Unmarshal_failsForSomethingNotAPointerToAStruct(t *testing.T) {
+	var s string
+	assertEquals(t, Unmarshal(List(), &s).Error(), "sexp: Unmarshal needs a non-nil pointer to a struct")
+	assertEquals(t, Unmarshal(List(), testPrivKeys{}).Error(), "sexp: Unmarshal needs a non-nil pointer to a struct")
+}
+
+func Test_Unmarshal_failsForAnAtom(t *testing.T) {
+	var res testPrivKeys
+	assertEquals(t, Unmarshal(Symbol("privkeys"), &res).Error(), "sexp: expected a list to decode into sexp.testPrivKeys")
+}
+
+func Test_Unmarshal_failsForAFieldWithTheWrongType(t *testing.T) {
+	var res testAccount
+	err := Unmarshal(Read(inp(`(account (name #12#))`)), &res)
+	assertEquals(t, err.Error(), "sexp: expected a string or a symbol in (name #12#)")
+
+	err = Unmarshal(Read(inp(`(account (private-key (dsa (p "12"))))`)), &res)
+	assertEquals(t, err.Error(), "sexp: expected a number in (p \"12\")")
+
+	err = Unmarshal(Read(inp(`(account (name "a" "b"))`)), &res)
+	assertEquals(t, err.Error(), "sexp: expected a single value in (name \"a\" \"b\")")
+}
+
+func Test_Unmarshal_failsForUnsupportedFieldTypes(t *testing.T) {
+	var res struct {
+		Count int `sexp:"count"`
+	}
+	err := Unmarshal(Read(inp(`(thing (count 1))`)), &res)
+	assertEquals(t, err.Error(), "sexp: can't decode into a value of type int")
+}
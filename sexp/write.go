@@ -0,0 +1,105 @@
+package sexp
+
+import (
+	"io"
+	"strings"
+)
+
+const prettyIndent = "  "
+
+// Write will write the value to the writer in a form that Read will read back as the same value
+func Write(w io.Writer, v Value) error {
+	_, err := io.WriteString(w, format(v))
+	return err
+}
+
+// Marshal returns the value formatted as an S-Expression, in a form that Read will read back as the same value
+func Marshal(v Value) []byte {
+	return []byte(format(v))
+}
+
+// WritePretty will write the value to the writer like Write does, but with every list that contains other lists
+// spread out over several lines, indenting each item on its own line. The value is written piece by piece without
+// being collected anywhere first, so w decides where the formatted value ends up.
+func WritePretty(w io.Writer, v Value) error {
+	p := &prettyWriter{w: w}
+	p.write(v, "")
+	return p.err
+}
+
+// listItems returns the items of a proper list, and false if the value is not one
+func listItems(v Value) ([]Value, bool) {
+	var result []Value
+	for {
+		switch c := v.(type) {
+		case Snil:
+			return result, true
+		case Cons:
+			result = append(result, c.first)
+			v = c.second
+		default:
+			return result, false
+		}
+	}
+}
+
+func format(v Value) string {
+	c, ok := v.(Cons)
+	if !ok {
+		if v == nil {
+			return snil.String()
+		}
+		return v.String()
+	}
+
+	items := []string{format(c.first)}
+	rest := c.second
+	for {
+		switch r := rest.(type) {
+		case Snil:
+			return "(" + strings.Join(items, " ") + ")"
+		case Cons:
+			items = append(items, format(r.first))
+			rest = r.second
+		default:
+			return "(" + strings.Join(items, " ") + " . " + format(rest) + ")"
+		}
+	}
+}
+
+func containsList(items []Value) bool {
+	for _, i := range items {
+		if _, ok := i.(Cons); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// prettyWriter writes pretty-printed values, and remembers the first error from the underlying writer
+type prettyWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *prettyWriter) writeString(s string) {
+	if p.err == nil {
+		_, p.err = io.WriteString(p.w, s)
+	}
+}
+
+func (p *prettyWriter) write(v Value, indent string) {
+	items, proper := listItems(v)
+	if !proper || !containsList(items) {
+		p.writeString(format(v))
+		return
+	}
+
+	p.writeString("(")
+	p.write(items[0], indent+prettyIndent)
+	for _, i := range items[1:] {
+		p.writeString("\n" + indent + prettyIndent)
+		p.write(i, indent+prettyIndent)
+	}
+	p.writeString("\n" + indent + ")")
+}
@@ -0,0 +1,78 @@
+package sexp
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+func roundTrip(v Value) Value {
+	return Read(inp(string(Marshal(v))))
+}
+
+func Test_Marshal_formatsAtoms(t *testing.T) {
+	assertEquals(t, string(Marshal(Symbol("hello"))), "hello")
+	assertEquals(t, string(Marshal(Sstring("hello"))), "\"hello\"")
+	assertEquals(t, string(Marshal(NewBigNum("123FFCADDD"))), "#123FFCADDD#")
+	assertEquals(t, string(Marshal(Snil{})), "()")
+}
+
+func Test_Marshal_formatsProperListsWithoutDots(t *testing.T) {
+	v := List(Symbol("name"), Sstring("alice"), List(Symbol("x"), NewBigNum("1F")))
+	assertEquals(t, string(Marshal(v)), "(name \"alice\" (x #1F#))")
+}
+
+func Test_Marshal_formatsImproperListsWithADot(t *testing.T) {
+	v := NewCons(Symbol("a"), NewCons(Symbol("b"), Symbol("c")))
+	assertEquals(t, string(Marshal(v)), "(a b . c)")
+}
+
+func Test_Marshal_escapesStrings(t *testing.T) {
+	assertEquals(t, string(Marshal(Sstring("a \"b\" \\ c\n"))), "\"a \\\"b\\\" \\\\ c\\n\"")
+}
+
+func Test_Marshal_roundTripsAllValueTypes(t *testing.T) {
+	values := []Value{
+		Symbol("hello"),
+		Sstring("with \"quotes\", a \\ backslash,\ta tab and\r\na newline"),
+		NewBigNumFromInt(big.NewInt(0x1234)),
+		Snil{},
+		List(),
+		List(Symbol("privkeys"), List(Symbol("name"), Sstring("alice")), NewBigNum("00FF")),
+		NewCons(Symbol("a"), Sstring("b")),
+		NewCons(Symbol("a"), NewCons(Symbol("b"), NewBigNum("AB"))),
+	}
+
+	for _, v := range values {
+		assertDeepEquals(t, roundTrip(v), v)
+	}
+}
+
+func Test_Write_writesTheMarshaledValue(t *testing.T) {
+	var b bytes.Buffer
+	_ = Write(&b, List(Symbol("a"), Sstring("b")))
+	assertEquals(t, b.String(), "(a \"b\")")
+}
+
+func Test_WritePretty_indentsNestedLists(t *testing.T) {
+	v := List(Symbol("privkeys"),
+		List(Symbol("account"),
+			List(Symbol("name"), Sstring("alice")),
+			List(Symbol("private-key"),
+				List(Symbol("dsa"),
+					List(Symbol("p"), NewBigNum("0A"))))))
+
+	var b bytes.Buffer
+	_ = WritePretty(&b, v)
+	assertEquals(t, b.String(), `(privkeys
+  (account
+    (name "alice")
+    (private-key
+      (dsa
+        (p #A#)
+      )
+    )
+  )
+)`)
+	assertDeepEquals(t, Read(inp(b.String())), v)
+}
@@ -11,6 +11,9 @@ type smp struct {
 	s1       *smp1State
 	s2       *smp2State
 	s3       *smp3State
+	session  *SMPSession
+
+	abortPending bool
 }
 
 const smpVersion = 1
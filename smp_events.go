@@ -39,6 +39,11 @@ func (d dynamicSMPEventHandler) HandleSMPEvent(event SMPEvent, pp int, question
 }
 
 func (c *Conversation) smpEvent(e SMPEvent, percent int) {
+	if r, ok := smpResultFor(e); ok {
+		c.finishSMPSession(r)
+	}
+	c.metricsForSMPEvent(e)
+
 	if c.smpEventHandler != nil {
 		c.smpEventHandler.HandleSMPEvent(e, percent, "")
 	}
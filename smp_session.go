@@ -0,0 +1,175 @@
+package otr3
+
+import (
+	"context"
+	"sync"
+)
+
+// SMPResult is the outcome of an SMP session
+type SMPResult int
+
+const (
+	// SMPResultSuccess means that the peer provided the same secret as we did
+	SMPResultSuccess SMPResult = iota
+	// SMPResultFailure means that the peer provided a different secret. When the peer is the first to notice this,
+	// it will abort the SMP instead of finishing it, and the result will be SMPResultAborted
+	SMPResultFailure
+	// SMPResultCheated means that the peer sent an SMP message that failed verification
+	SMPResultCheated
+	// SMPResultAborted means that the SMP session was aborted, by us, by the peer or because of a protocol error
+	SMPResultAborted
+)
+
+// String returns the string representation of the SMPResult
+func (r SMPResult) String() string {
+	switch r {
+	case SMPResultSuccess:
+		return "SMPResultSuccess"
+	case SMPResultFailure:
+		return "SMPResultFailure"
+	case SMPResultCheated:
+		return "SMPResultCheated"
+	case SMPResultAborted:
+		return "SMPResultAborted"
+	default:
+		return "SMP RESULT: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// SMPSession tracks the outcome of an SMP run started with StartAuthenticateSession.
+// Wait can be called from any goroutine. The SMP messages themselves are still sent and received
+// through the conversation, which has to keep processing messages for the session to finish.
+type SMPSession struct {
+	lock           sync.Mutex
+	done           chan struct{}
+	finished       bool
+	abortRequested bool
+	result         SMPResult
+}
+
+func newSMPSession() *SMPSession {
+	return &SMPSession{done: make(chan struct{})}
+}
+
+// Wait blocks until the SMP session has finished, and returns its result.
+// If the context is done first, the session is aborted and the error of the context is returned. The SMP abort message
+// will be included in the messages returned from the next call to Send or Receive on the conversation.
+func (s *SMPSession) Wait(ctx context.Context) (SMPResult, error) {
+	select {
+	case <-s.done:
+		return s.result, nil
+	case <-ctx.Done():
+		if s.requestAbort() {
+			return SMPResultAborted, ctx.Err()
+		}
+		return s.result, nil
+	}
+}
+
+// Done returns a channel that is closed when the SMP session has finished
+func (s *SMPSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// requestAbort finishes the session as aborted, and returns false if it had already finished
+func (s *SMPSession) requestAbort() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.finished {
+		return false
+	}
+
+	s.abortRequested = true
+	s.finishLocked(SMPResultAborted)
+	return true
+}
+
+func (s *SMPSession) finish(r SMPResult) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.finished {
+		s.finishLocked(r)
+	}
+}
+
+func (s *SMPSession) finishLocked(r SMPResult) {
+	s.finished = true
+	s.result = r
+	close(s.done)
+}
+
+func (s *SMPSession) wasAbortRequested() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.abortRequested
+}
+
+// StartAuthenticateSession works like StartAuthenticate, but also returns an SMPSession that can be used to wait for the result of the authentication.
+// Starting a new authentication aborts any session already in progress.
+func (c *Conversation) StartAuthenticateSession(question string, mutualSecret []byte) (*SMPSession, []ValidMessage, error) {
+	msgs, err := c.StartAuthenticate(question, mutualSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.finishSMPSession(SMPResultAborted)
+	c.smp.session = newSMPSession()
+
+	return c.smp.session, msgs, nil
+}
+
+func (c *Conversation) finishSMPSession(r SMPResult) {
+	if c.smp.session != nil {
+		c.smp.session.finish(r)
+		c.smp.session = nil
+	}
+}
+
+func smpResultFor(e SMPEvent) (SMPResult, bool) {
+	switch e {
+	case SMPEventSuccess:
+		return SMPResultSuccess, true
+	case SMPEventFailure:
+		return SMPResultFailure, true
+	case SMPEventCheated:
+		return SMPResultCheated, true
+	case SMPEventAbort, SMPEventError:
+		return SMPResultAborted, true
+	}
+	return 0, false
+}
+
+// abortCancelledSMPSession restarts the SMP state machine as soon as we notice a session whose Wait has given up,
+// so that no SMP message arriving after that can finish the session. It returns true if it did so.
+// The abort message is sent to the peer by sendPendingSMPAbort.
+func (c *Conversation) abortCancelledSMPSession() bool {
+	if c.smp.session == nil || !c.smp.session.wasAbortRequested() {
+		return false
+	}
+
+	c.smp.session = nil
+	c.smp.wipe()
+	c.smp.ensureSMP()
+	c.smp.abortPending = true
+	return true
+}
+
+// sendPendingSMPAbort injects the abort message for a cancelled session, to go out with the next messages we send
+func (c *Conversation) sendPendingSMPAbort() {
+	if !c.smp.abortPending {
+		return
+	}
+
+	c.smp.abortPending = false
+	if c.msgState != encrypted {
+		return
+	}
+
+	msgs, _, _ := c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{smpMessageAbort{}.tlv()})
+	for _, m := range msgs {
+		c.injectMessage(m)
+	}
+}
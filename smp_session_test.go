@@ -0,0 +1,146 @@
+package otr3
+
+import (
+	"context"
+	"testing"
+)
+
+func runSMPWithSession(t *testing.T, aliceSecret, bobSecret []byte) (*SMPSession, *Conversation, *Conversation) {
+	alice, bob := fixtureEncryptedConversations()
+
+	session, toBob, err := alice.StartAuthenticateSession("", aliceSecret)
+	assertNil(t, err)
+
+	_, _, _ = bob.Receive(toBob[0])
+	toAlice, _ := bob.ProvideAuthenticationSecret(bobSecret)
+	_, toBob, _ = alice.Receive(toAlice[0])
+	_, toAlice, _ = bob.Receive(toBob[0])
+	_, _, _ = alice.Receive(toAlice[0])
+
+	return session, alice, bob
+}
+
+func Test_SMPSession_Wait_returnsSuccessForTheSameSecret(t *testing.T) {
+	session, _, _ := runSMPWithSession(t, []byte("secret"), []byte("secret"))
+
+	res, err := session.Wait(context.Background())
+	assertNil(t, err)
+	assertEquals(t, res, SMPResultSuccess)
+}
+
+func Test_SMPSession_Wait_returnsAbortedWhenThePeerNoticesDifferentSecrets(t *testing.T) {
+	session, _, _ := runSMPWithSession(t, []byte("secret"), []byte("other secret"))
+
+	res, err := session.Wait(context.Background())
+	assertNil(t, err)
+	assertEquals(t, res, SMPResultAborted)
+}
+
+func Test_SMPSession_finishesWithFailureOnAFailureEvent(t *testing.T) {
+	c := &Conversation{}
+	c.smp.session = newSMPSession()
+	session := c.smp.session
+
+	c.smpEvent(SMPEventFailure, 100)
+
+	res, _ := session.Wait(context.Background())
+	assertEquals(t, res, SMPResultFailure)
+	assertEquals(t, c.smp.session, (*SMPSession)(nil))
+}
+
+func Test_SMPSession_Wait_returnsAbortedWhenThePeerAborts(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	session, toBob, _ := alice.StartAuthenticateSession("", []byte("secret"))
+	_, _, _ = bob.Receive(toBob[0])
+
+	toAlice, _ := bob.AbortAuthentication()
+	_, _, _ = alice.Receive(toAlice[0])
+
+	res, err := session.Wait(context.Background())
+	assertNil(t, err)
+	assertEquals(t, res, SMPResultAborted)
+}
+
+func Test_SMPSession_Wait_abortsTheSessionWhenTheContextIsDone(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	session, toBob, _ := alice.StartAuthenticateSession("", []byte("secret"))
+	_, _, _ = bob.Receive(toBob[0])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	res, err := session.Wait(ctx)
+	assertEquals(t, err, context.Canceled)
+	assertEquals(t, res, SMPResultAborted)
+
+	toBob, err = alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	assertEquals(t, len(toBob), 2)
+
+	var events []SMPEvent
+	bob.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) { events = append(events, e) }}
+	plain, _, _ := bob.Receive(toBob[0])
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	_, _, _ = bob.Receive(toBob[1])
+	assertDeepEquals(t, events, []SMPEvent{SMPEventAbort})
+	assertEquals(t, alice.smp.session, (*SMPSession)(nil))
+}
+
+func Test_SMPSession_Wait_cancellingStopsTheSessionBeforeTheLastSMPMessageArrives(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	store := memoryTrustStore{}
+	alice.SetTrustStore(store, "bob", "alice", "xmpp")
+
+	session, toBob, _ := alice.StartAuthenticateSession("", []byte("secret"))
+	_, _, _ = bob.Receive(toBob[0])
+	toAlice, _ := bob.ProvideAuthenticationSecret([]byte("secret"))
+	_, toBob, _ = alice.Receive(toAlice[0])
+	_, toAlice, _ = bob.Receive(toBob[0])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, _ := session.Wait(ctx)
+	assertEquals(t, res, SMPResultAborted)
+
+	var events []SMPEvent
+	alice.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) { events = append(events, e) }}
+	_, toBob, err := alice.Receive(toAlice[0])
+	assertNil(t, err)
+	assertNil(t, events)
+	assertEquals(t, alice.TrustLevel(), Unverified)
+	assertEquals(t, len(store), 0)
+
+	assertEquals(t, len(toBob), 1)
+	bob.smpEventHandler = dynamicSMPEventHandler{func(e SMPEvent, _ int, _ string) { events = append(events, e) }}
+	_, _, _ = bob.Receive(toBob[0])
+	assertDeepEquals(t, events, []SMPEvent{SMPEventAbort})
+}
+
+func Test_SMPSession_Wait_returnsTheResultIfTheSessionFinishedBeforeTheContext(t *testing.T) {
+	session, _, _ := runSMPWithSession(t, []byte("secret"), []byte("secret"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	<-session.Done()
+	res, _ := session.Wait(ctx)
+	assertEquals(t, res, SMPResultSuccess)
+}
+
+func Test_StartAuthenticateSession_abortsThePreviousSession(t *testing.T) {
+	alice, _ := fixtureEncryptedConversations()
+	first, _, _ := alice.StartAuthenticateSession("", []byte("secret"))
+	second, _, _ := alice.StartAuthenticateSession("", []byte("secret"))
+
+	res, _ := first.Wait(context.Background())
+	assertEquals(t, res, SMPResultAborted)
+	assertEquals(t, alice.smp.session, second)
+}
+
+func Test_SMPResult_String(t *testing.T) {
+	assertEquals(t, SMPResultSuccess.String(), "SMPResultSuccess")
+	assertEquals(t, SMPResultFailure.String(), "SMPResultFailure")
+	assertEquals(t, SMPResultCheated.String(), "SMPResultCheated")
+	assertEquals(t, SMPResultAborted.String(), "SMPResultAborted")
+	assertEquals(t, SMPResult(42).String(), "SMP RESULT: (THIS SHOULD NEVER HAPPEN)")
+}
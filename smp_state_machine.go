@@ -47,7 +47,17 @@ func (c *Conversation) abortStateMachineAndNotifyCheated() (smpState, smpMessage
 }
 
 func (c *Conversation) receiveSMP(m smpMessage) (*tlv, error) {
+	if c.abortCancelledSMPSession() {
+		// Our abort will end the run this message belongs to, unless the peer is starting a new one
+		if _, ok := m.(smp1Message); !ok {
+			return nil, nil
+		}
+		c.smp.abortPending = false
+	}
+
+	before := c.smpStateName()
 	toSend, err := m.receivedMessage(c)
+	c.logDebug("SMP step", "from", before, "to", c.smpStateName())
 
 	if err != nil {
 		return nil, err
@@ -63,7 +73,11 @@ func (c *Conversation) receiveSMP(m smpMessage) (*tlv, error) {
 }
 
 func (c *Conversation) continueSMP(mutualSecret []byte) (*tlv, error) {
+	c.abortCancelledSMPSession()
+
+	before := c.smpStateName()
 	toSend, err := c.continueMessage(mutualSecret)
+	c.logDebug("SMP step", "from", before, "to", c.smpStateName())
 
 	if err != nil {
 		return nil, err
@@ -133,11 +147,19 @@ func (s smpStateWaitingForSecret) continueMessage1(c *Conversation, mutualSecret
 }
 
 func (smpStateExpect2) receiveMessage2(c *Conversation, m smp2Message) (smpState, smpMessage, error) {
+	if c.contextErr() != nil {
+		return c.abortSMPForContext()
+	}
+
 	err := c.verifySMP2(c.smp.s1, m)
 	if err != nil {
 		return c.abortStateMachineAndNotifyCheated()
 	}
 
+	if c.contextErr() != nil {
+		return c.abortSMPForContext()
+	}
+
 	s3, err := c.generateSMP3(c.smp.secret, *c.smp.s1, m)
 	if err != nil {
 		return c.abortStateMachineAndNotifyCheated()
@@ -151,17 +173,25 @@ func (smpStateExpect2) receiveMessage2(c *Conversation, m smp2Message) (smpState
 }
 
 func (smpStateExpect3) receiveMessage3(c *Conversation, m smp3Message) (smpState, smpMessage, error) {
+	if c.contextErr() != nil {
+		return c.abortSMPForContext()
+	}
+
 	err := c.verifySMP3(c.smp.s2, m)
 	if err != nil {
 		return c.abortStateMachineAndNotifyCheated()
 	}
 
+	if c.contextErr() != nil {
+		return c.abortSMPForContext()
+	}
+
 	err = c.verifySMP3ProtocolSuccess(c.smp.s2, m)
 	if err != nil {
 		c.smpEvent(SMPEventFailure, 100)
 		return sendSMPAbortAndRestartStateMachine()
 	}
-	c.smpEvent(SMPEventSuccess, 100)
+	c.smpSucceeded()
 
 	ret, err := c.generateSMP4(c.smp.secret, *c.smp.s2, m)
 	if err != nil {
@@ -173,22 +203,39 @@ func (smpStateExpect3) receiveMessage3(c *Conversation, m smp3Message) (smpState
 }
 
 func (smpStateExpect4) receiveMessage4(c *Conversation, m smp4Message) (smpState, smpMessage, error) {
+	if c.contextErr() != nil {
+		return c.abortSMPForContext()
+	}
+
 	err := c.verifySMP4(c.smp.s3, m)
 	if err != nil {
 		return c.abortStateMachineAndNotifyCheated()
 	}
 
+	if c.contextErr() != nil {
+		return c.abortSMPForContext()
+	}
+
 	err = c.verifySMP4ProtocolSuccess(c.smp.s1, c.smp.s3, m)
 	if err != nil {
 		c.smpEvent(SMPEventFailure, 100)
 		return sendSMPAbortAndRestartStateMachine()
 	}
-	c.smpEvent(SMPEventSuccess, 100)
+	c.smpSucceeded()
 
 	c.smp.wipe()
 	return smpStateExpect1{}, nil, nil
 }
 
+func (c *Conversation) smpSucceeded() {
+	c.smpEvent(SMPEventSuccess, 100)
+
+	// Like libotr, answering a question from the peer only proves who we are to them, not who they are to us
+	if c.smp.question == nil {
+		c.markTheirKeyVerifiedBySMP()
+	}
+}
+
 func (m smp1Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
 	c.smp.state, ret, err = c.smp.state.receiveMessage1(c, m)
 	return
@@ -0,0 +1,73 @@
+package otr3
+
+// Snapshot describes the state of a conversation at one point in time. It contains the same information as the
+// debug dump, in a form that can be used by programs - for example by marshalling it to JSON.
+// It never contains secret material.
+type Snapshot struct {
+	MessageState    string `json:"message_state"`
+	AuthState       string `json:"auth_state"`
+	SMPState        string `json:"smp_state"`
+	ProtocolVersion uint16 `json:"protocol_version"`
+	WhitespaceOffer string `json:"whitespace_offer"`
+
+	OurInstanceTag   uint32 `json:"our_instance_tag"`
+	TheirInstanceTag uint32 `json:"their_instance_tag"`
+
+	OurKeyID   uint32            `json:"our_key_id"`
+	TheirKeyID uint32            `json:"their_key_id"`
+	Counters   []SnapshotCounter `json:"counters"`
+
+	OurFingerprint   string `json:"our_fingerprint,omitempty"`
+	TheirFingerprint string `json:"their_fingerprint,omitempty"`
+	SSID             string `json:"ssid,omitempty"`
+}
+
+// SnapshotCounter is the top half of the counters used for the data messages sent with a pair of key IDs
+type SnapshotCounter struct {
+	OurKeyID     uint32 `json:"our_key_id"`
+	TheirKeyID   uint32 `json:"their_key_id"`
+	OurCounter   uint64 `json:"our_counter"`
+	TheirCounter uint64 `json:"their_counter"`
+}
+
+// Snapshot returns a description of the current state of the conversation
+func (c *Conversation) Snapshot() Snapshot {
+	s := Snapshot{
+		MessageState:     c.msgState.identityString(),
+		AuthState:        c.akeStateName(),
+		SMPState:         c.smpStateName(),
+		WhitespaceOffer:  c.otrOffer(),
+		OurInstanceTag:   c.ourInstanceTag,
+		TheirInstanceTag: c.theirInstanceTag,
+		OurKeyID:         c.keys.ourKeyID,
+		TheirKeyID:       c.keys.theirKeyID,
+		Counters:         []SnapshotCounter{},
+	}
+
+	if c.version != nil {
+		s.ProtocolVersion = c.version.protocolVersion()
+	}
+
+	for _, ctr := range c.keys.counterHistory.counters {
+		s.Counters = append(s.Counters, SnapshotCounter{
+			OurKeyID:     ctr.ourKeyID,
+			TheirKeyID:   ctr.theirKeyID,
+			OurCounter:   ctr.ourCounter,
+			TheirCounter: ctr.theirCounter,
+		})
+	}
+
+	if c.ourCurrentKey != nil {
+		s.OurFingerprint = FormatFingerprint(c.ourCurrentKey.PublicKey().Fingerprint())
+	}
+
+	if c.theirKey != nil {
+		s.TheirFingerprint = FormatFingerprint(c.theirKey.Fingerprint())
+	}
+
+	if c.msgState == encrypted {
+		s.SSID = FormatFingerprint(c.ssid[:])
+	}
+
+	return s
+}
@@ -0,0 +1,56 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+)
+
+func Test_Snapshot_ofANewConversation(t *testing.T) {
+	c := &Conversation{}
+	s := c.Snapshot()
+
+	assertEquals(t, s.MessageState, "PLAINTEXT")
+	assertEquals(t, s.AuthState, "NONE")
+	assertEquals(t, s.SMPState, "EXPECT1")
+	assertEquals(t, s.ProtocolVersion, uint16(0))
+	assertEquals(t, s.WhitespaceOffer, "NOT")
+	assertEquals(t, s.OurFingerprint, "")
+	assertEquals(t, s.TheirFingerprint, "")
+	assertEquals(t, s.SSID, "")
+	assertEquals(t, len(s.Counters), 0)
+}
+
+func Test_Snapshot_ofAnEncryptedConversation(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	_, _, err := bob.Receive(sendOne(t, alice, "hello"))
+	assertNil(t, err)
+
+	s := bob.Snapshot()
+	assertEquals(t, s.MessageState, "ENCRYPTED")
+	assertEquals(t, s.ProtocolVersion, uint16(3))
+	assertEquals(t, s.OurInstanceTag, bob.ourInstanceTag)
+	assertEquals(t, s.TheirInstanceTag, alice.ourInstanceTag)
+	assertEquals(t, s.OurKeyID, bob.keys.ourKeyID)
+	assertEquals(t, s.TheirKeyID, bob.keys.theirKeyID)
+	assertEquals(t, s.OurFingerprint, FormatFingerprint(bobPrivateKey.PublicKey().Fingerprint()))
+	assertEquals(t, s.TheirFingerprint, FormatFingerprint(alicePrivateKey.PublicKey().Fingerprint()))
+	assertEquals(t, s.SSID, FormatFingerprint(bob.ssid[:]))
+	assertEquals(t, len(s.Counters), len(bob.keys.counterHistory.counters))
+	for i, ctr := range bob.keys.counterHistory.counters {
+		assertEquals(t, s.Counters[i], SnapshotCounter{ctr.ourKeyID, ctr.theirKeyID, ctr.ourCounter, ctr.theirCounter})
+	}
+}
+
+func Test_Snapshot_marshalsToJSON(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.keys.counterHistory.findCounterFor(1, 2).ourCounter = 3
+
+	b, err := json.Marshal(c.Snapshot())
+	assertNil(t, err)
+	assertEquals(t, string(b), `{"message_state":"PLAINTEXT","auth_state":"NONE","smp_state":"EXPECT1","protocol_version":3,"whitespace_offer":"NOT","our_instance_tag":257,"their_instance_tag":257,"our_key_id":0,"their_key_id":0,"counters":[{"our_key_id":1,"their_key_id":2,"our_counter":3,"their_counter":0}]}`)
+
+	var s Snapshot
+	assertNil(t, json.Unmarshal(b, &s))
+	assertDeepEquals(t, s, c.Snapshot())
+}
@@ -0,0 +1,50 @@
+package otr3
+
+var errCantRefreshWithoutEncryption = newOtrError("can't refresh a conversation that is not encrypted")
+
+// StartAKE starts the AKE with the given protocol version by generating a DH-Commit message, without
+// sending a query message first. This should only be used when the versions the peer supports are already
+// known - otherwise, send a QueryMessage. The version has to be allowed by the policies and, if the conversation
+// has already committed to a protocol version, be that version.
+func (c *Conversation) StartAKE(version int) ([]ValidMessage, error) {
+	if err := c.commitToAKEVersion(version); err != nil {
+		return nil, err
+	}
+
+	ts, err := c.sendDHCommit()
+	toSend, err := c.potentialAuthError(compactMessagesWithHeader(ts), err)
+	if err != nil {
+		return c.withInjections(nil, err)
+	}
+
+	return c.withInjections(c.encodeAndCombine(toSend), nil)
+}
+
+// Refresh runs the AKE again for an encrypted conversation, generating new keys and a new ssid. The old session is
+// kept, and can be used for sending and receiving messages until the new AKE has finished. When it has,
+// the StillSecure security event is signalled.
+func (c *Conversation) Refresh() ([]ValidMessage, error) {
+	if c.msgState != encrypted {
+		return nil, errCantRefreshWithoutEncryption
+	}
+
+	c.logInfo("refreshing conversation")
+	return c.StartAKE(int(c.version.protocolVersion()))
+}
+
+func (c *Conversation) commitToAKEVersion(version int) error {
+	if version != 2 && version != 3 {
+		return errUnsupportedOTRVersion
+	}
+
+	// commitToVersionFrom doesn't look at the policies once a version has been committed to, so they are checked here
+	if _, err := newOtrVersion(uint16(version), c.Policies); err != nil {
+		return errUnsupportedOTRVersion
+	}
+
+	if c.version != nil && c.version.protocolVersion() != uint16(version) {
+		return errWrongProtocolVersion
+	}
+
+	return c.commitToVersionFrom(1 << uint(version))
+}
@@ -0,0 +1,117 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func Test_StartAKE_generatesADHCommitMessageThatFinishesTheAKE(t *testing.T) {
+	alice, bob := fixtureConversationPair()
+	var events []SecurityEvent
+	bob.SetSecurityEventHandler(dynamicSecurityEventHandler{func(e SecurityEvent) {
+		events = append(events, e)
+	}})
+
+	toSend, err := alice.StartAKE(3)
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessDHCommit)
+
+	exchangeAll(t, alice, bob, toSend)
+
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+	assertEquals(t, alice.ssid, bob.ssid)
+	assertDeepEquals(t, events, []SecurityEvent{GoneSecure})
+}
+
+func Test_StartAKE_returnsAnErrorForAVersionNotAllowedByThePolicies(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = Policy(allowV2)
+	c.SetOurKeys([]PrivateKey{alicePrivateKey})
+
+	_, err := c.StartAKE(3)
+	assertEquals(t, err, errUnsupportedOTRVersion)
+
+	_, err = c.StartAKE(4)
+	assertEquals(t, err, errUnsupportedOTRVersion)
+	assertNil(t, c.ake)
+}
+
+func Test_StartAKE_returnsAnErrorForVersionsThatOnlyLookAllowedWhenTruncated(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = policies(allowV2 | allowV3)
+	c.SetOurKeys([]PrivateKey{alicePrivateKey})
+	c.version = otrV3{}
+
+	for _, v := range []int{65536 + 3, -65536 + 3} {
+		_, err := c.StartAKE(v)
+		assertEquals(t, err, errUnsupportedOTRVersion)
+	}
+	assertNil(t, c.ake)
+}
+
+func Test_StartAKE_returnsAnErrorForAnotherVersionThanTheOneCommittedTo(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = Policy(allowV2 | allowV3)
+	c.SetOurKeys([]PrivateKey{alicePrivateKey})
+	c.version = otrV3{}
+
+	_, err := c.StartAKE(2)
+	assertEquals(t, err, errWrongProtocolVersion)
+}
+
+func Test_StartAKE_returnsAnErrorForTheVersionCommittedToIfThePoliciesNoLongerAllowIt(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = Policy(allowV2)
+	c.SetOurKeys([]PrivateKey{alicePrivateKey})
+	c.version = otrV3{}
+
+	_, err := c.StartAKE(3)
+	assertEquals(t, err, errUnsupportedOTRVersion)
+	assertNil(t, c.ake)
+}
+
+func Test_Refresh_returnsAnErrorIfTheConversationIsNotEncrypted(t *testing.T) {
+	alice, _ := fixtureConversationPair()
+
+	toSend, err := alice.Refresh()
+	assertEquals(t, err, errCantRefreshWithoutEncryption)
+	assertNil(t, toSend)
+}
+
+func Test_Refresh_keepsTheOldSessionUntilTheNewAKEHasFinished(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	oldSSID := alice.ssid
+	var aliceEvents, bobEvents []SecurityEvent
+	alice.SetSecurityEventHandler(dynamicSecurityEventHandler{func(e SecurityEvent) {
+		aliceEvents = append(aliceEvents, e)
+	}})
+	bob.SetSecurityEventHandler(dynamicSecurityEventHandler{func(e SecurityEvent) {
+		bobEvents = append(bobEvents, e)
+	}})
+
+	dhCommit, err := alice.Refresh()
+	assertNil(t, err)
+	_, dhKey, err := bob.Receive(dhCommit[0])
+	assertNil(t, err)
+	_, revealSig, err := alice.Receive(dhKey[0])
+	assertNil(t, err)
+
+	assertTrue(t, alice.IsEncrypted())
+	assertEquals(t, alice.ssid, oldSSID)
+	plain, _, err := bob.Receive(sendOne(t, alice, "still here"))
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("still here"))
+
+	exchangeAll(t, alice, bob, revealSig)
+
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+	assertEquals(t, alice.ssid, bob.ssid)
+	assertFalse(t, alice.ssid == oldSSID)
+	assertDeepEquals(t, aliceEvents, []SecurityEvent{StillSecure})
+	assertDeepEquals(t, bobEvents, []SecurityEvent{StillSecure})
+
+	exchangeMessages(t, alice, bob, 2)
+}
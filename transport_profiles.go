@@ -0,0 +1,61 @@
+package otr3
+
+import "math"
+
+// transportProfiles are the largest messages, in bytes, that can be sent over some well known networks. These are the
+// values used by the libotr plugins. A zero means that the network has no limit that matters for OTR messages.
+var transportProfiles = map[string]uint16{
+	"xmpp":   0,
+	"irc":    417,
+	"aim":    2343,
+	"icq":    2346,
+	"msn":    1409,
+	"yahoo":  799,
+	"gg":     1999,
+	"novell": 1792,
+}
+
+// TransportProfile returns the largest message, in bytes, that can be sent over a well known network, and whether
+// the network is known. The networks known are xmpp, irc, aim, icq, msn, yahoo, gg and novell, with the values
+// used by the libotr plugins. A zero means that the network has no limit that matters for OTR messages.
+func TransportProfile(name string) (size uint16, ok bool) {
+	size, ok = transportProfiles[name]
+	return
+}
+
+// MaxMessageSizeFunc returns the largest message, in bytes, that can be sent to the peer of the given conversation right now.
+// This includes the fragment prefixes added to the message. A value of zero or less means that there is no limit.
+type MaxMessageSizeFunc func(c *Conversation) int
+
+// SetTransportProfile sets the fragment size to the limit of one of the networks known by TransportProfile
+func (c *Conversation) SetTransportProfile(name string) error {
+	size, ok := TransportProfile(name)
+	if !ok {
+		return newOtrErrorf("unknown transport profile: %s", name)
+	}
+
+	c.SetFragmentSize(size)
+	return nil
+}
+
+// SetMaxMessageSizeFunc sets a function that will be asked for the largest message that can be sent every time
+// messages are about to be sent, like the max_message_size callback of libotr. It is given the conversation sending the
+// messages, so one function can serve many peers. When it is set, it is used instead of the fragment size.
+func (c *Conversation) SetMaxMessageSizeFunc(f MaxMessageSizeFunc) {
+	c.maxMessageSize = f
+}
+
+func (c *Conversation) currentFragmentSize() uint16 {
+	if c.maxMessageSize == nil {
+		return c.fragmentSize
+	}
+
+	size := c.maxMessageSize(c)
+	switch {
+	case size <= 0:
+		return 0
+	case size > math.MaxUint16:
+		return math.MaxUint16
+	}
+	return uint16(size)
+}
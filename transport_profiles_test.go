@@ -0,0 +1,129 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func Test_SetTransportProfile_setsTheFragmentSizeOfTheNetwork(t *testing.T) {
+	c := &Conversation{}
+
+	assertNil(t, c.SetTransportProfile("irc"))
+	assertEquals(t, c.fragmentSize, uint16(417))
+
+	assertNil(t, c.SetTransportProfile("xmpp"))
+	assertEquals(t, c.fragmentSize, uint16(0))
+}
+
+func Test_TransportProfile_looksUpTheSizeForANetwork(t *testing.T) {
+	size, ok := TransportProfile("yahoo")
+	assertTrue(t, ok)
+	assertEquals(t, size, uint16(799))
+
+	_, ok = TransportProfile("carrier pigeon")
+	assertFalse(t, ok)
+}
+
+func Test_SetTransportProfile_returnsAnErrorForAnUnknownNetwork(t *testing.T) {
+	c := &Conversation{}
+	c.SetFragmentSize(100)
+
+	err := c.SetTransportProfile("carrier pigeon")
+	assertEquals(t, err, newOtrError("unknown transport profile: carrier pigeon"))
+	assertEquals(t, c.fragmentSize, uint16(100))
+}
+
+func Test_SetMaxMessageSizeFunc_isAskedForTheSizeEveryTimeMessagesAreSent(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	size := 0
+	alice.SetFragmentSize(50)
+	var askedFor *Conversation
+	alice.SetMaxMessageSizeFunc(func(c *Conversation) int {
+		askedFor = c
+		return size
+	})
+
+	toSend, err := alice.Send(ValidMessage("a message that is long enough to need fragmentation"))
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, askedFor, alice)
+
+	for _, size = range []int{417, 120} {
+		toSend, err = alice.Send(ValidMessage("a message that is long enough to need fragmentation"))
+		assertNil(t, err)
+		assertTrue(t, len(toSend) > 1)
+		for _, m := range toSend {
+			assertTrue(t, len(m) <= size)
+		}
+
+		received := receiveAll(t, bob, stringsOf(toSend)...)
+		assertDeepEquals(t, received, []string{"a message that is long enough to need fragmentation"})
+	}
+}
+
+func Test_currentFragmentSize_limitsTheSizeToTheLargestFragmentSize(t *testing.T) {
+	c := &Conversation{}
+	c.SetMaxMessageSizeFunc(func(*Conversation) int { return 100000 })
+	assertEquals(t, c.currentFragmentSize(), uint16(65535))
+
+	c.SetMaxMessageSizeFunc(func(*Conversation) int { return -1 })
+	assertEquals(t, c.currentFragmentSize(), uint16(0))
+}
+
+func Test_fragment_accountsForThePrefixOfTheProtocolVersion(t *testing.T) {
+	data := []byte("one one one two two two three three three")
+
+	for _, v := range []otrVersion{otrV2{}, otrV3{}} {
+		c := newConversation(v, rand.Reader)
+		c.ourInstanceTag = defaultInstanceTag
+		c.theirInstanceTag = defaultInstanceTag + 1
+
+		for _, m := range c.fragment(data, 40) {
+			assertTrue(t, len(m) <= 40)
+		}
+	}
+}
+
+func Test_fragment_doesntFragmentIfTheSizeDoesntLeaveRoomForThePrefix(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourInstanceTag = defaultInstanceTag
+	c.theirInstanceTag = defaultInstanceTag + 1
+	data := []byte("one two three")
+
+	assertDeepEquals(t, c.fragment(data, 10), []ValidMessage{data})
+}
+
+func Test_fragment_doesntSendAnEmptyFragmentWhenTheDataFillsTheLastOneExactly(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	prefix := len(c.version.fragmentPrefix(1, 1, 0, 0)) + 1
+
+	fragments := c.fragment([]byte("one two...three.....four......"), uint16(prefix+10))
+	assertDeepEquals(t, stringsOf(fragments), []string{
+		"?OTR,00001,00003,one two...,",
+		"?OTR,00002,00003,three.....,",
+		"?OTR,00003,00003,four......,",
+	})
+}
+
+func Test_fragment_doesntFragmentIfTheMessageNeedsMoreFragmentsThanTheLimit(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourInstanceTag = defaultInstanceTag
+	c.theirInstanceTag = defaultInstanceTag + 1
+	// The prefix of version 3 takes up 36 of the 37 bytes, leaving one byte of data in every fragment
+	data := bytes.Repeat([]byte{'a'}, 70000)
+
+	assertDeepEquals(t, c.fragment(data, 37), []ValidMessage{data})
+
+	fragments := c.fragment(data[:65535], 37)
+	assertEquals(t, len(fragments), 65535)
+	assertDeepEquals(t, fragments[65534], ValidMessage("?OTR|00000100|00000101,65535,65535,a,"))
+}
+
+func stringsOf(msgs []ValidMessage) []string {
+	result := make([]string, len(msgs))
+	for i, m := range msgs {
+		result[i] = string(m)
+	}
+	return result
+}
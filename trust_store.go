@@ -0,0 +1,238 @@
+package otr3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TrustSMP is the trust value libotr records for fingerprints verified with the Socialist Millionaires' Protocol
+const TrustSMP = "smp"
+
+// TrustVerified is the trust value libotr records for fingerprints the user has verified manually
+const TrustVerified = "verified"
+
+// TrustLevel describes whether we have verified the identity of our peer
+type TrustLevel int
+
+const (
+	// Unverified means that the fingerprint of the peer is not trusted
+	Unverified TrustLevel = iota
+	// Verified means that the fingerprint of the peer has been verified, either manually or using SMP
+	Verified
+)
+
+// String returns the string representation of the TrustLevel
+func (t TrustLevel) String() string {
+	switch t {
+	case Unverified:
+		return "Unverified"
+	case Verified:
+		return "Verified"
+	default:
+		return "TRUST LEVEL: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// TrustStore keeps track of which fingerprints of our peers are trusted.
+// A fingerprint is trusted if it has a non-empty trust value.
+type TrustStore interface {
+	// Trust returns the trust value of the fingerprint for the given peer, account and protocol, or the empty string if it isn't trusted
+	Trust(peer, account, protocol string, fingerprint []byte) string
+	// SetTrust records the trust value of the fingerprint for the given peer, account and protocol
+	SetTrust(peer, account, protocol string, fingerprint []byte, trust string) error
+}
+
+// FingerprintEntry is a fingerprint of a peer, as stored in the libotr fingerprints file
+type FingerprintEntry struct {
+	Peer        string
+	Account     string
+	Protocol    string
+	Fingerprint []byte
+	Trust       string
+}
+
+func (e *FingerprintEntry) matches(peer, account, protocol string, fingerprint []byte) bool {
+	return e.Peer == peer && e.Account == account && e.Protocol == protocol && bytes.Equal(e.Fingerprint, fingerprint)
+}
+
+// ImportFingerprints will read the libotr formatted fingerprints given and return all entries defined in it
+func ImportFingerprints(r io.Reader) ([]*FingerprintEntry, error) {
+	var result []*FingerprintEntry
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r\n")
+		if line == "" {
+			continue
+		}
+
+		parts := strings.Split(line, "\t")
+		if len(parts) < 4 || len(parts) > 5 {
+			return nil, newOtrError("couldn't import fingerprints - invalid line")
+		}
+
+		fp, err := hex.DecodeString(parts[3])
+		if err != nil {
+			return nil, newOtrError("couldn't import fingerprints - invalid fingerprint")
+		}
+
+		e := &FingerprintEntry{Peer: parts[0], Account: parts[1], Protocol: parts[2], Fingerprint: fp}
+		if len(parts) == 5 {
+			e.Trust = parts[4]
+		}
+		result = append(result, e)
+	}
+
+	return result, s.Err()
+}
+
+// ExportFingerprints will write all the given entries in the libotr fingerprints format
+func ExportFingerprints(entries []*FingerprintEntry, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		_, _ = bw.WriteString(fmt.Sprintf("%s\t%s\t%s\t%x\t%s\n", e.Peer, e.Account, e.Protocol, e.Fingerprint, e.Trust))
+	}
+	return bw.Flush()
+}
+
+// ImportFingerprintsFromFile will read the libotr formatted fingerprints file given and return all entries defined in it
+func ImportFingerprintsFromFile(fname string) ([]*FingerprintEntry, error) {
+	f, err := os.Open(filepath.Clean(fname))
+	if err != nil {
+		return nil, err
+	}
+
+	res, e := ImportFingerprints(f)
+	if e != nil {
+		_ = f.Close()
+		return nil, e
+	}
+
+	return res, f.Close()
+}
+
+// ExportFingerprintsToFile will create the named file (or truncate it) and write all the entries to that file in libotr format.
+func ExportFingerprintsToFile(entries []*FingerprintEntry, fname string) error {
+	f, err := os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := ExportFingerprints(entries, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// FileTrustStore is a TrustStore backed by a file in the libotr fingerprints format.
+// Every change to the trust of a fingerprint is written to the file immediately.
+type FileTrustStore struct {
+	fname   string
+	entries []*FingerprintEntry
+}
+
+// NewFileTrustStore creates a TrustStore that reads and writes the given file. It is not an error for the file to not exist yet.
+func NewFileTrustStore(fname string) (*FileTrustStore, error) {
+	entries, err := ImportFingerprintsFromFile(fname)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &FileTrustStore{fname: fname, entries: entries}, nil
+}
+
+// Entries returns all fingerprints known to this store
+func (s *FileTrustStore) Entries() []*FingerprintEntry {
+	return s.entries
+}
+
+// Trust returns the trust value of the fingerprint for the given peer, account and protocol, or the empty string if it isn't trusted
+func (s *FileTrustStore) Trust(peer, account, protocol string, fingerprint []byte) string {
+	for _, e := range s.entries {
+		if e.matches(peer, account, protocol, fingerprint) {
+			return e.Trust
+		}
+	}
+	return ""
+}
+
+// SetTrust records the trust value of the fingerprint and writes the file
+func (s *FileTrustStore) SetTrust(peer, account, protocol string, fingerprint []byte, trust string) error {
+	found := false
+	for _, e := range s.entries {
+		if e.matches(peer, account, protocol, fingerprint) {
+			e.Trust = trust
+			found = true
+		}
+	}
+
+	if !found {
+		s.entries = append(s.entries, &FingerprintEntry{
+			Peer:        peer,
+			Account:     account,
+			Protocol:    protocol,
+			Fingerprint: makeCopy(fingerprint),
+			Trust:       trust,
+		})
+	}
+
+	return ExportFingerprintsToFile(s.entries, s.fname)
+}
+
+type trustContext struct {
+	store                   TrustStore
+	peer, account, protocol string
+}
+
+// SetTrustStore assigns the store used to decide whether the fingerprint of the peer is trusted.
+// The peer, account and protocol identify this conversation in the store.
+// A successful SMP run will mark the fingerprint of the peer as trusted in the store, unless we only answered a question
+// asked by the peer.
+func (c *Conversation) SetTrustStore(store TrustStore, peer, account, protocol string) {
+	c.trust = trustContext{store, peer, account, protocol}
+}
+
+// TrustLevel returns whether the key the peer is currently using has been verified
+func (c *Conversation) TrustLevel() TrustLevel {
+	if c.trust.store == nil || c.theirKey == nil {
+		return Unverified
+	}
+
+	if c.trust.store.Trust(c.trust.peer, c.trust.account, c.trust.protocol, c.theirKey.Fingerprint()) == "" {
+		return Unverified
+	}
+
+	return Verified
+}
+
+// signalTrustLevel tells whether the peer is using a trusted key, when a trust store is set
+func (c *Conversation) signalTrustLevel() {
+	if c.trust.store == nil {
+		return
+	}
+
+	level := c.TrustLevel()
+	c.signalSecurityEventIf(level == Verified, GoneVerified)
+	c.signalSecurityEventIf(level == Unverified, GoneUnverified)
+}
+
+func (c *Conversation) markTheirKeyVerifiedBySMP() {
+	if c.trust.store == nil || c.theirKey == nil {
+		return
+	}
+
+	// A fingerprint the user has already verified keeps its existing trust value
+	if c.TrustLevel() == Verified {
+		return
+	}
+
+	if err := c.trust.store.SetTrust(c.trust.peer, c.trust.account, c.trust.protocol, c.theirKey.Fingerprint(), TrustSMP); err == nil {
+		c.securityEvent(GoneVerified)
+	}
+}
@@ -0,0 +1,160 @@
+package otr3
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+const fixtureFingerprints = "bob@example.org\talice@example.org\tprpl-jabber\t0102030405060708090a0b0c0d0e0f1011121314\tsmp\n" +
+	"carol@example.org\talice@example.org\tprpl-jabber\t1112131415161718191a1b1c1d1e1f2021222324\t\n"
+
+type memoryTrustStore map[string]string
+
+func (s memoryTrustStore) Trust(peer, account, protocol string, fingerprint []byte) string {
+	return s[string(fingerprint)]
+}
+
+func (s memoryTrustStore) SetTrust(peer, account, protocol string, fingerprint []byte, trust string) error {
+	s[string(fingerprint)] = trust
+	return nil
+}
+
+func Test_ImportFingerprints_readsTheLibotrFormat(t *testing.T) {
+	res, err := ImportFingerprints(bytes.NewBufferString(fixtureFingerprints))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 2)
+	assertDeepEquals(t, *res[0], FingerprintEntry{
+		Peer:        "bob@example.org",
+		Account:     "alice@example.org",
+		Protocol:    "prpl-jabber",
+		Fingerprint: bytesFromHex("0102030405060708090a0b0c0d0e0f1011121314"),
+		Trust:       TrustSMP,
+	})
+	assertEquals(t, res[1].Trust, "")
+}
+
+func Test_ImportFingerprints_returnsAnErrorForInvalidLines(t *testing.T) {
+	_, err := ImportFingerprints(bytes.NewBufferString("bob\talice\n"))
+	assertNotNil(t, err)
+
+	_, err = ImportFingerprints(bytes.NewBufferString("bob\talice\tprpl-jabber\tqqqq\t\n"))
+	assertNotNil(t, err)
+}
+
+func Test_ExportFingerprints_writesTheLibotrFormat(t *testing.T) {
+	res, _ := ImportFingerprints(bytes.NewBufferString(fixtureFingerprints))
+
+	var buf bytes.Buffer
+	assertNil(t, ExportFingerprints(res, &buf))
+	assertEquals(t, buf.String(), fixtureFingerprints)
+}
+
+func Test_FileTrustStore_writesChangesToTheFile(t *testing.T) {
+	fname := "test_resources/test_fingerprints.blah"
+	defer os.Remove(fname)
+
+	s, err := NewFileTrustStore(fname)
+	assertNil(t, err)
+	assertEquals(t, s.Trust("bob", "alice", "xmpp", []byte{0x01}), "")
+
+	assertNil(t, s.SetTrust("bob", "alice", "xmpp", []byte{0x01}, TrustVerified))
+
+	s2, err := NewFileTrustStore(fname)
+	assertNil(t, err)
+	assertEquals(t, s2.Trust("bob", "alice", "xmpp", []byte{0x01}), TrustVerified)
+	assertEquals(t, s2.Trust("bob", "alice", "irc", []byte{0x01}), "")
+	assertEquals(t, len(s2.Entries()), 1)
+}
+
+func Test_Conversation_TrustLevel_isUnverifiedWithoutATrustStore(t *testing.T) {
+	c := &Conversation{theirKey: bobPrivateKey.PublicKey()}
+	assertEquals(t, c.TrustLevel(), Unverified)
+}
+
+func Test_Conversation_TrustLevel_usesTheTrustStore(t *testing.T) {
+	store := memoryTrustStore{}
+	c := &Conversation{theirKey: bobPrivateKey.PublicKey()}
+	c.SetTrustStore(store, "bob", "alice", "xmpp")
+	assertEquals(t, c.TrustLevel(), Unverified)
+
+	store[string(bobPrivateKey.PublicKey().Fingerprint())] = TrustVerified
+	assertEquals(t, c.TrustLevel(), Verified)
+}
+
+func Test_Conversation_successfulSMPMarksTheirKeyAsVerified(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	store := memoryTrustStore{}
+	alice.SetTrustStore(store, "bob", "alice", "xmpp")
+
+	var events []SecurityEvent
+	alice.securityEventHandler = dynamicSecurityEventHandler{func(event SecurityEvent) {
+		events = append(events, event)
+	}}
+
+	toSend, _ := bob.StartAuthenticate("", []byte("secret"))
+	_, _, _ = alice.Receive(toSend[0])
+	toSend, _ = alice.ProvideAuthenticationSecret([]byte("secret"))
+	_, toSend, _ = bob.Receive(toSend[0])
+	_, _, _ = alice.Receive(toSend[0])
+
+	assertEquals(t, alice.TrustLevel(), Verified)
+	assertEquals(t, store[string(bobPrivateKey.PublicKey().Fingerprint())], TrustSMP)
+	assertDeepEquals(t, events, []SecurityEvent{GoneVerified})
+}
+
+func Test_Conversation_successfulSMPDoesntMarkTheirKeyWhenWeAnsweredTheirQuestion(t *testing.T) {
+	alice, bob := fixtureEncryptedConversations()
+	store := memoryTrustStore{}
+	alice.SetTrustStore(store, "bob", "alice", "xmpp")
+
+	toSend, _ := bob.StartAuthenticate("What's the clue?", []byte("secret"))
+	_, _, _ = alice.Receive(toSend[0])
+	toSend, _ = alice.ProvideAuthenticationSecret([]byte("secret"))
+	_, toSend, _ = bob.Receive(toSend[0])
+
+	alice.expectSMPEvent(t, func() {
+		_, _, _ = alice.Receive(toSend[0])
+	}, SMPEventSuccess, 100, "")
+	assertEquals(t, alice.TrustLevel(), Unverified)
+	assertEquals(t, len(store), 0)
+}
+
+func Test_Conversation_signalsTheTrustLevelOfThePeerWhenTheAKEFinishes(t *testing.T) {
+	alice, bob := fixtureConversationPair()
+	store := memoryTrustStore{}
+	bob.SetTrustStore(store, "alice", "bob", "xmpp")
+
+	var events []SecurityEvent
+	bob.SetSecurityEventHandler(dynamicSecurityEventHandler{func(e SecurityEvent) {
+		events = append(events, e)
+	}})
+
+	toSend, _ := alice.StartAKE(3)
+	exchangeAll(t, alice, bob, toSend)
+	assertDeepEquals(t, events, []SecurityEvent{GoneSecure, GoneUnverified})
+
+	store[string(alicePrivateKey.PublicKey().Fingerprint())] = TrustVerified
+	events = nil
+	toSend, _ = alice.Refresh()
+	exchangeAll(t, alice, bob, toSend)
+	assertDeepEquals(t, events, []SecurityEvent{StillSecure, GoneVerified})
+}
+
+func Test_Conversation_successfulSMPKeepsAnExistingTrustValue(t *testing.T) {
+	c := &Conversation{theirKey: bobPrivateKey.PublicKey()}
+	store := memoryTrustStore{string(bobPrivateKey.PublicKey().Fingerprint()): TrustVerified}
+	c.SetTrustStore(store, "bob", "alice", "xmpp")
+
+	c.doesntExpectSecurityEvent(t, func() {
+		c.markTheirKeyVerifiedBySMP()
+	})
+	assertEquals(t, store[string(bobPrivateKey.PublicKey().Fingerprint())], TrustVerified)
+}
+
+func Test_TrustLevel_hasValidStringImplementation(t *testing.T) {
+	assertEquals(t, Unverified.String(), "Unverified")
+	assertEquals(t, Verified.String(), "Verified")
+	assertEquals(t, TrustLevel(42).String(), "TRUST LEVEL: (THIS SHOULD NEVER HAPPEN)")
+}
@@ -90,10 +90,12 @@ func (c *Conversation) commitToVersionFrom(versions int) error {
 	case c.Policies.has(allowV2) && versions&(1<<2) > 0:
 		version = otrV2{}
 	default:
+		c.logWarn("no version allowed by policy", "offered_versions", versions)
 		return errUnsupportedOTRVersion
 	}
 
 	c.version = version
+	c.logDebug("version chosen", "version", version.protocolVersion())
 
 	return c.setKeyMatchingVersion()
 }
@@ -79,9 +79,12 @@ func (c *Conversation) processWhitespaceTag(message ValidMessage) (plain Message
 	plain, versions := extractWhitespaceTag(message)
 
 	if !c.Policies.has(whitespaceStartAKE) {
+		c.logDebug("whitespace tag ignored by policy")
 		return
 	}
 
+	c.logDebug("starting AKE from whitespace tag")
+
 	toSend, err = c.startAKEFromWhitespaceTag(versions)
 	return
 }
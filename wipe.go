@@ -5,6 +5,7 @@ import (
 	"math/big"
 	"reflect"
 	"runtime"
+	"time"
 	"unsafe"
 )
 
@@ -55,6 +56,8 @@ func (a *ake) wipe(wipeKeys bool) {
 	a.revealKey.wipe()
 	a.sigKey.unlock()
 	a.sigKey.wipe()
+	a.started = time.Time{}
+	wipeBytes(a.ssid[:])
 
 	if wipeKeys {
 		a.keys.wipe()
@@ -106,12 +109,15 @@ func (c *keyManagementContext) wipe() {
 
 	c.counterHistory.wipe()
 	c.macKeyHistory.wipe()
+	c.receiveWindow.wipe()
+	c.replays.wipe()
 }
 
 func (c *keyManagementContext) wipeAndKeepRevealKeys() keyManagementContext {
 	ret := keyManagementContext{}
 	ret.oldMACKeys = make([]macKey, len(c.oldMACKeys))
 	copy(ret.oldMACKeys, c.oldMACKeys)
+	ret.oldMACKeys = append(ret.oldMACKeys, c.receiveWindow.heldBack()...)
 
 	c.wipe()
 